@@ -0,0 +1,97 @@
+/*
+Purpose:
+- GeoJSON output for OSM data pre-processing
+
+Description:
+- Minimal GeoJSON types (point features only) and file writer.
+- Point features from OSM nodes (tags as properties).
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+
+	"github.com/paulmach/osm"
+)
+
+// geoJSONFeatureCollection defines a GeoJSON feature collection
+type geoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+// geoJSONFeature defines a GeoJSON feature
+type geoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   geoJSONGeometry        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// geoJSONGeometry defines a GeoJSON point geometry
+type geoJSONGeometry struct {
+	Type        string    `json:"type"`
+	Coordinates []float64 `json:"coordinates"`
+}
+
+/*
+newPointFeature creates new GeoJSON point feature
+*/
+func newPointFeature(lon, lat float64, properties map[string]interface{}) geoJSONFeature {
+	return geoJSONFeature{
+		Type:       "Feature",
+		Geometry:   geoJSONGeometry{Type: "Point", Coordinates: []float64{lon, lat}},
+		Properties: properties,
+	}
+}
+
+/*
+newNodeFeature creates GeoJSON point feature from OSM node (tags as properties, plus @id and @action)
+*/
+func newNodeFeature(node *osm.Node, action string) geoJSONFeature {
+	properties := make(map[string]interface{}, len(node.Tags)+2)
+	for _, tag := range node.Tags {
+		properties[tag.Key] = tag.Value
+	}
+	properties["@id"] = int64(node.ID)
+	properties["@action"] = action
+	return newPointFeature(node.Lon, node.Lat, properties)
+}
+
+/*
+writeGeoJSONFile writes features as GeoJSON feature collection to file
+*/
+func writeGeoJSONFile(filename string, features []geoJSONFeature) error {
+	file, err := createOutput(filename)
+	if err != nil {
+		return fmt.Errorf("could not open file: %v", err)
+	}
+
+	if features == nil {
+		features = []geoJSONFeature{}
+	}
+	collection := geoJSONFeatureCollection{Type: "FeatureCollection", Features: features}
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(collection)
+	if err != nil {
+		return fmt.Errorf("error writing file: %v", err)
+	}
+	err = writer.Flush()
+	if err != nil {
+		return fmt.Errorf("could not flush file buffer: %v", err)
+	}
+
+	return file.Close()
+}
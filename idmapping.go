@@ -0,0 +1,60 @@
+/*
+Purpose:
+- ID mapping file
+
+Description:
+- CSV file with one row per new node: derived ID, source ID, network type (e.g. node_bicycle), source
+  key (e.g. rcn_ref) and ref (e.g. 53) (e.g. for audits).
+- An existing mapping file is read at start. New nodes of known source nodes get the recorded ID again
+  (see package process). The file is rewritten at the end of the run.
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+
+	"github.com/Klaus-Tockloth/osmpp/process"
+)
+
+/*
+loadIDMapping reads ID mapping file (a missing file results in an empty mapping)
+*/
+func loadIDMapping(filename string) (*process.IDMapping, error) {
+	mapping := process.NewIDMapping()
+
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return mapping, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not open file: %v", err)
+	}
+	defer file.Close()
+
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("could not read file: %v", err)
+	}
+	err = mapping.Load(records)
+	if err != nil {
+		return nil, err
+	}
+	return mapping, nil
+}
+
+/*
+writeIDMapping writes ID mapping file (sorted by derived ID)
+*/
+func writeIDMapping(filename string, mapping *process.IDMapping) error {
+	return writeCSVFile(filename, mapping.Records())
+}
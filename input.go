@@ -0,0 +1,229 @@
+/*
+Purpose:
+- OSM input handling
+
+Description:
+- Detects the format of the OSM input from the magic bytes of the data (fallback: file extension).
+- Supported formats: PBF, XML, gzip compressed XML (.osm.gz), bzip2 compressed XML (.osm.bz2).
+- Several input files are given as comma-separated list and/or glob patterns (e.g. "states/*.osm.pbf").
+- Filename "-" reads from stdin (e.g. 'osmium cat -o - -f pbf ... | osmpp -inputOSM=- ...').
+- XML files (e.g. Overpass downloads) usually lack the 'visible' attribute. Objects read from XML
+  are therefore marked as visible (as objects read from PBF).
+- Other objects of XML files (e.g. bounds) are skipped, only nodes, ways and relations are passed on
+  (as from PBF).
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmpbf"
+	"github.com/paulmach/osm/osmxml"
+)
+
+// number of bytes used for format detection
+const magicSize = 512
+
+// filename for stdin (input) and stdout (output)
+const stdioFilename = "-"
+
+/*
+openInput opens input file (or stdin)
+*/
+func openInput(filename string) (io.ReadCloser, error) {
+	if filename == stdioFilename {
+		return ioutil.NopCloser(os.Stdin), nil
+	}
+	return os.Open(filename)
+}
+
+/*
+openInputScanner opens input file (or stdin) and creates scanner (closing the scanner closes the file)
+*/
+func openInputScanner(filename string) (osm.Scanner, string, error) {
+	fileInput, err := openInput(filename)
+	if err != nil {
+		return nil, "", fmt.Errorf("could not open file: %v", err)
+	}
+	scanner, inputFormat, err := newOSMScanner(context.Background(), fileInput, filename)
+	if err != nil {
+		fileInput.Close()
+		return nil, "", fmt.Errorf("could not create scanner: %v", err)
+	}
+	return &inputScanner{Scanner: scanner, file: fileInput}, inputFormat, nil
+}
+
+// inputScanner closes the input file together with the scanner
+type inputScanner struct {
+	osm.Scanner
+	file io.Closer
+}
+
+/*
+Close closes scanner and input file
+*/
+func (s *inputScanner) Close() error {
+	err := s.Scanner.Close()
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+/*
+expandInputFiles expands comma-separated list of input files and glob patterns
+*/
+func expandInputFiles(list string) ([]string, error) {
+	var inputFiles []string
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			return nil, fmt.Errorf("empty input filename in '%s'", list)
+		}
+		if !strings.ContainsAny(entry, "*?[") {
+			inputFiles = append(inputFiles, entry)
+			continue
+		}
+		matches, err := filepath.Glob(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob pattern '%s': %v", entry, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no input file matches '%s'", entry)
+		}
+		inputFiles = append(inputFiles, matches...)
+	}
+
+	if len(inputFiles) > 1 {
+		for _, inputFile := range inputFiles {
+			if inputFile == stdioFilename {
+				return nil, fmt.Errorf("stdin (%s) cannot be combined with other input files", stdioFilename)
+			}
+		}
+	}
+	return inputFiles, nil
+}
+
+/*
+inputBaseName returns base name of input file without OSM file extensions (e.g. "bremen.osm.pbf" -> "bremen")
+*/
+func inputBaseName(filename string) string {
+	if filename == stdioFilename {
+		return "stdin"
+	}
+	name := filepath.Base(filename)
+	for _, ext := range []string{".gz", ".bz2", ".pbf", ".osm"} {
+		name = strings.TrimSuffix(name, ext)
+	}
+	return name
+}
+
+/*
+newOSMScanner creates scanner for OSM input (format detected from data or filename)
+*/
+func newOSMScanner(ctx context.Context, r io.Reader, filename string) (osm.Scanner, string, error) {
+	reader := bufio.NewReaderSize(r, 64*1024)
+	magic, err := reader.Peek(magicSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, "", fmt.Errorf("could not read input: %v", err)
+	}
+
+	compression := ""
+	var data io.Reader = reader
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		compression = "gzip"
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, "", fmt.Errorf("could not read gzip input: %v", err)
+		}
+		data = gzipReader
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		compression = "bzip2"
+		data = bzip2.NewReader(reader)
+	}
+
+	if compression != "" {
+		// compressed data is always XML
+		reader = bufio.NewReaderSize(data, 64*1024)
+		return &xmlScanner{osmxml.New(ctx, reader)}, "XML (" + compression + ")", nil
+	}
+
+	if isXML(magic) {
+		return &xmlScanner{osmxml.New(ctx, reader)}, "XML", nil
+	}
+	if bytes.Contains(magic, []byte("OSMHeader")) {
+		return osmpbf.New(ctx, reader, 3), "PBF", nil
+	}
+
+	// fallback: file extension
+	if strings.HasSuffix(strings.ToLower(filename), ".osm") {
+		return &xmlScanner{osmxml.New(ctx, reader)}, "XML", nil
+	}
+	return osmpbf.New(ctx, reader, 3), "PBF", nil
+}
+
+/*
+isXML checks if data starts with XML content (optional byte order mark and whitespace)
+*/
+func isXML(magic []byte) bool {
+	data := bytes.TrimPrefix(magic, []byte{0xef, 0xbb, 0xbf})
+	data = bytes.TrimLeft(data, " \t\r\n")
+	return bytes.HasPrefix(data, []byte("<?xml")) || bytes.HasPrefix(data, []byte("<osm"))
+}
+
+// xmlScanner passes on nodes, ways and relations read from XML (marked as visible)
+type xmlScanner struct {
+	*osmxml.Scanner
+}
+
+/*
+Scan advances to next node, way or relation (other objects, e.g. bounds, are skipped)
+*/
+func (s *xmlScanner) Scan() bool {
+	for s.Scanner.Scan() {
+		switch s.Scanner.Object().(type) {
+		case *osm.Node, *osm.Way, *osm.Relation:
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Object returns current object (marked as visible)
+*/
+func (s *xmlScanner) Object() osm.Object {
+	switch e := s.Scanner.Object().(type) {
+	case *osm.Node:
+		e.Visible = true
+		return e
+	case *osm.Way:
+		e.Visible = true
+		return e
+	case *osm.Relation:
+		e.Visible = true
+		return e
+	default:
+		return e
+	}
+}
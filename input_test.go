@@ -0,0 +1,149 @@
+/*
+Purpose:
+- Tests of OSM input handling
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/paulmach/osm"
+)
+
+/*
+TestNewOSMScanner detects input format and reads nodes, ways and relations (bounds are skipped)
+*/
+func TestNewOSMScanner(t *testing.T) {
+	xmlData, err := ioutil.ReadFile("testdata/bounds.osm")
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	bzip2Data, err := ioutil.ReadFile("testdata/bounds.osm.bz2")
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+
+	var gzipData bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipData)
+	_, err = gzipWriter.Write(xmlData)
+	if err != nil {
+		t.Fatalf("gzip Write: %v", err)
+	}
+	err = gzipWriter.Close()
+	if err != nil {
+		t.Fatalf("gzip Close: %v", err)
+	}
+
+	// PBF data with the same objects as the XML data
+	var pbfData bytes.Buffer
+	encoder := newPBFEncoder(&pbfData, "osmpp-test")
+	scanner, _, err := newOSMScanner(context.Background(), bytes.NewReader(xmlData), "bounds.osm")
+	if err != nil {
+		t.Fatalf("newOSMScanner: %v", err)
+	}
+	for scanner.Scan() {
+		err = encoder.WriteObject(scanner.Object())
+		if err != nil {
+			t.Fatalf("WriteObject: %v", err)
+		}
+	}
+	scanner.Close()
+	err = encoder.Close()
+	if err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	bom := append([]byte{0xef, 0xbb, 0xbf}, xmlData...)
+	// no XML declaration and no root element at start (format derived from file extension)
+	undetectable := append([]byte("<!-- OSM data -->\n"), bytes.SplitN(xmlData, []byte("\n"), 2)[1]...)
+
+	expected := []osm.ObjectID{
+		osm.NodeID(10).ObjectID(1),
+		osm.NodeID(11).ObjectID(2),
+		osm.WayID(30).ObjectID(1),
+		osm.RelationID(40).ObjectID(1),
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		filename string
+		format   string
+		valid    bool // data readable in detected format
+	}{
+		{"xml", xmlData, "bounds.osm", "XML", true},
+		{"xml stdin", xmlData, stdioFilename, "XML", true},
+		{"xml other extension", xmlData, "bounds.dat", "XML", true},
+		{"xml with bom", bom, "bounds.osm", "XML", true},
+		{"gzip", gzipData.Bytes(), "bounds.osm.gz", "XML (gzip)", true},
+		{"bzip2", bzip2Data, "bounds.osm.bz2", "XML (bzip2)", true},
+		{"pbf", pbfData.Bytes(), "bounds.osm.pbf", "PBF", true},
+		{"pbf other extension", pbfData.Bytes(), "bounds.osm", "PBF", true},
+		{"extension fallback xml", undetectable, "bounds.OSM", "XML", true},
+		{"extension fallback pbf", undetectable, "bounds.dat", "PBF", false},
+	}
+
+	for _, test := range tests {
+		scanner, format, err := newOSMScanner(context.Background(), bytes.NewReader(test.data), test.filename)
+		if err != nil {
+			t.Errorf("%s: newOSMScanner: %v", test.name, err)
+			continue
+		}
+		if format != test.format {
+			t.Errorf("%s: format %s, expected %s", test.name, format, test.format)
+		}
+
+		objectIDs := []osm.ObjectID{}
+		for scanner.Scan() {
+			object := scanner.Object()
+			objectIDs = append(objectIDs, object.ObjectID())
+			if format != "PBF" && !isVisible(object) {
+				t.Errorf("%s: %v not marked as visible", test.name, object.ObjectID())
+			}
+		}
+		err = scanner.Err()
+		scanner.Close()
+
+		if !test.valid {
+			if err == nil {
+				t.Errorf("%s: error expected", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: scanner error: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(objectIDs, expected) {
+			t.Errorf("%s: objects %v, expected %v", test.name, objectIDs, expected)
+		}
+	}
+}
+
+/*
+isVisible reports whether node, way or relation is marked as visible
+*/
+func isVisible(object osm.Object) bool {
+	switch e := object.(type) {
+	case *osm.Node:
+		return e.Visible
+	case *osm.Way:
+		return e.Visible
+	case *osm.Relation:
+		return e.Visible
+	}
+	return false
+}
@@ -55,19 +55,19 @@ Links:
 package main
 
 import (
-	"bufio"
-	"context"
-	"encoding/xml"
 	"flag"
 	"fmt"
+	"io"
 	"log"
-	"math"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/Klaus-Tockloth/osmpp/process"
 	"github.com/paulmach/osm"
-	"github.com/paulmach/osm/osmpbf"
 )
 
 // general program info
@@ -79,8 +79,8 @@ var (
 	progInfo    = "Processes node_network and turning_circle objects."
 )
 
-// node ID for new node objects
-var newNodeID osm.NodeID
+// console output (stdout, stderr if data is written to stdout)
+var console io.Writer = os.Stdout
 
 /*
 init initializes this program
@@ -96,655 +96,572 @@ main starts this program
 */
 func main() {
 
-	fmt.Printf("\nProgram:\n")
-	fmt.Printf("  Name                    : %s\n", progName)
-	fmt.Printf("  Release                 : %s - %s\n", progVersion, progDate)
-	fmt.Printf("  Purpose                 : %s\n", progPurpose)
-	fmt.Printf("  Info                    : %s\n", progInfo)
-
 	// command line options
-	inputOSM := flag.String("inputOSM", "", "name of OSM input file (PBF format)")
-	outputNodes := flag.String("outputNodes", "", "name of OSM nodes output file (XML format)")
-	startNode := flag.Int("startNode", 0, "starting ID for new nodes written to nodes output file")
+	inputOSM := flag.String("inputOSM", "", "name of OSM input file (PBF or XML format, XML optionally gzip or bzip2 compressed, - = stdin, comma-separated list or glob pattern for several input files)")
+	outputNodes := flag.String("outputNodes", "", "name of OSM nodes output file (XML, osmChange, PBF, GeoJSON or GeoJSONSeq format, comma-separated list for several output files, - = stdout)")
+	outputFormatName := flag.String("outputFormat", "", "format of nodes output file: xml = new and modified nodes only, osc = osmChange with new nodes (create) and modified nodes (modify), pbf = all input objects merged with new and modified nodes, geojson/geojsonseq = new and modified nodes as point features (comma-separated list for several output files, default = derived from file extension)")
+	idScheme := flag.String("idScheme", process.IDSchemeSequential, "ID scheme for new nodes: sequential = in order of creation, source = derived from source node ID and source key (stable across runs)")
+	idMappingFile := flag.String("idMapping", "", "name of ID mapping file (CSV format, optional, existing assignments are reused and the file is updated)")
+	idSlots := flag.Int("idSlots", 0, "number of ID slots per source node for ID scheme 'source' (default = 0 = number of source keys in rules)")
+	startNode := flag.String("startNode", "", "starting ID for new nodes written to nodes output file (number, auto = above maximum node ID of input, negative = -1, -2, ...)")
+	rulesFile := flag.String("rules", "", "name of rules file (JSON format, optional, default = built-in rules)")
+	allLevels := flag.Bool("allLevels", false, "write one new node per network level (default = first match only)")
+	withNames := flag.Bool("junctionNames", false, "carry junction name (e.g. rcn:name) and ref onto new nodes")
+	relationJunctions := flag.Bool("relationJunctions", false, "detect junctions without network:type tag through route relation membership")
+	displace := flag.Float64("displace", 0, "distance (meters) to spread co-located new nodes (default = 0 = no displacement)")
+	bearings := flag.String("displaceBearings", "0,180,90,270,45,225,135,315", "bearing pattern (degrees) for displacement of co-located new nodes")
+	pointDirection := flag.Bool("pointDirection", false, "add bearing of last way segment to dead-end point objects (e.g. tag fzk_turning:direction)")
+	nodeLocations := flag.String("nodeLocations", process.LocationStoreMap, "node location store for point directions: map = in-memory map, sparse = in-memory sparse array, dense = memory-mapped file indexed by node ID, sorted = on-disk file (requires input sorted by node ID, e.g. PBF)")
+	nodeLocationsFile := flag.String("nodeLocationsFile", "", "name of node location file for store dense or sorted (default = temporary file, removed after processing)")
+	pointPosition := flag.Bool("pointPosition", false, "add position (end, middle, orphan) to point objects (e.g. tag fzk_turning:position)")
+	qaPoints := flag.String("qaPoints", "", "base name of point object QA files (CSV and GeoJSON format, optional)")
+	pointAll := flag.Bool("pointAll", false, "record all way classes of point objects (e.g. tag fzk_turning:all)")
+	qaRelations := flag.String("qaRelations", "", "base name of route relation QA files (CSV and GeoJSON format, optional)")
+	statsOutput := flag.String("statsOutput", "", "name of statistics output file (JSON format, optional)")
+	outputPerInput := flag.Bool("outputPerInput", false, "write one nodes output file per input file (placeholder {input} in output filename, default = combined output)")
+	bbox := flag.String("bbox", "", "drop new and modified nodes outside bounding box (minLon,minLat,maxLon,maxLat)")
+	polygonFile := flag.String("polygon", "", "drop new and modified nodes outside polygon (name of polygon file, Osmosis .poly or GeoJSON format)")
+	multiPass := flag.Bool("multiPass", false, "read input file several times to reduce memory usage (relation junctions without candidates in memory, point directions without node locations of all nodes, not possible with stdin)")
+	processorList := flag.String("processors", "", "processing steps in processing order (comma-separated list of "+strings.Join(process.StepNames(), ", ")+", -name = disable step, default = all steps)")
 
 	flag.Usage = printProgUsage
 	flag.Parse()
 
-	if *inputOSM == "" || *outputNodes == "" || *startNode == 0 {
+	// console output (banner, statistics) must not corrupt data written to stdout
+	for _, filename := range strings.Split(*outputNodes, ",") {
+		if strings.TrimSpace(filename) == stdioFilename {
+			console = os.Stderr
+		}
+	}
+
+	fmt.Fprintf(console, "\nProgram:\n")
+	fmt.Fprintf(console, "  Name                    : %s\n", progName)
+	fmt.Fprintf(console, "  Release                 : %s - %s\n", progVersion, progDate)
+	fmt.Fprintf(console, "  Purpose                 : %s\n", progPurpose)
+	fmt.Fprintf(console, "  Info                    : %s\n", progInfo)
+
+	if *inputOSM == "" || *outputNodes == "" || *startNode == "" {
 		printProgUsage()
 	}
 
-	fmt.Printf("\nProcessing:\n")
-	fmt.Printf("  OSM input file          : %s\n", *inputOSM)
-	fmt.Printf("  Nodes output file       : %s\n", *outputNodes)
-	fmt.Printf("  Starting node ID        : %d\n", *startNode)
+	rules := process.DefaultRuleSet()
+	if *rulesFile != "" {
+		rs, err := process.LoadRuleSet(*rulesFile)
+		if err != nil {
+			log.Fatalf("error loading rules: %v", err)
+		}
+		rules = rs
+	}
 
-	fileInput, err := os.Open(*inputOSM)
+	fmt.Fprintf(console, "\nProcessing:\n")
+	inputFiles, err := expandInputFiles(*inputOSM)
 	if err != nil {
-		log.Fatalf("could not open file: %v", err)
+		log.Fatalf("invalid input files: %v", err)
 	}
-
-	fileOutput, err := os.OpenFile(*outputNodes, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0666)
+	for _, inputFile := range inputFiles {
+		fmt.Fprintf(console, "  OSM input file          : %s\n", inputFile)
+	}
+	outputFiles, err := parseOutputFiles(*outputNodes, *outputFormatName)
+	if err != nil {
+		log.Fatalf("invalid output files: %v", err)
+	}
+	err = checkOutputFiles(outputFiles, len(inputFiles), *outputPerInput)
 	if err != nil {
-		log.Fatalf("could not open file: %v", err)
+		log.Fatalf("invalid output files: %v", err)
+	}
+	for _, output := range outputFiles {
+		fmt.Fprintf(console, "  Nodes output file       : %s (%s)\n", output.Filename, output.Format)
 	}
-	writer := bufio.NewWriter(fileOutput)
-	_, err = fmt.Fprintf(writer, "<?xml version='1.0' encoding='UTF-8'?>\n")
+	startNodeID, nodeIDStep, err := parseStartNode(*startNode, inputFiles)
 	if err != nil {
-		log.Fatalf("error writing file: %v", err)
+		log.Fatalf("invalid startNode: %v", err)
 	}
-	_, err = fmt.Fprintf(writer, "<osm version='0.6' generator='%s'>\n", progName)
+	fmt.Fprintf(console, "  Starting node ID        : %d (%s)\n", startNodeID, *startNode)
+	nodeIDs, err := process.NewNodeIDs(*idScheme, startNodeID, nodeIDStep, *idSlots, rules)
 	if err != nil {
-		log.Fatalf("error writing file: %v", err)
+		log.Fatalf("invalid ID scheme: %v", err)
+	}
+	fmt.Fprintf(console, "  Node ID scheme          : %s", nodeIDs.Scheme)
+	if nodeIDs.Scheme == process.IDSchemeSource {
+		fmt.Fprintf(console, " (%d slots per source node)", nodeIDs.Slots)
+	}
+	fmt.Fprintf(console, "\n")
+	if *idMappingFile != "" {
+		nodeIDs.Mapping, err = loadIDMapping(*idMappingFile)
+		if err != nil {
+			log.Fatalf("error loading ID mapping: %v", err)
+		}
+		fmt.Fprintf(console, "  ID mapping file         : %s (%d entries)\n", *idMappingFile, nodeIDs.Mapping.Len())
+	}
+	if *rulesFile != "" {
+		fmt.Fprintf(console, "  Rules file              : %s\n", *rulesFile)
+	} else {
+		fmt.Fprintf(console, "  Rules file              : (built-in)\n")
+	}
+	processors, err := parseProcessors(*processorList)
+	if err != nil {
+		log.Fatalf("invalid processors: %v", err)
+	}
+	fmt.Fprintf(console, "  Processors              : %s\n", strings.Join(processors, ", "))
+	if *multiPass {
+		for _, inputFile := range inputFiles {
+			if inputFile == stdioFilename {
+				log.Fatalf("multiPass requires input file (input is read several times, not possible with stdin)")
+			}
+		}
+	}
+	fmt.Fprintf(console, "  Multi-pass              : %v\n", *multiPass)
+	fmt.Fprintf(console, "  All network levels      : %v\n", *allLevels)
+	fmt.Fprintf(console, "  Junction names          : %v\n", *withNames)
+	fmt.Fprintf(console, "  Relation junctions      : %v\n", *relationJunctions)
+	if *displace > 0 {
+		fmt.Fprintf(console, "  Displacement            : %v m (bearings %s)\n", *displace, *bearings)
+	}
+	for _, rule := range rules.PointEnrichments {
+		fmt.Fprintf(console, "  %-23s : %s (%s)\n", rule.Name, strings.Join(rule.WayValues, ", "), rule.OutputKey)
+	}
+	fmt.Fprintf(console, "  Point all classes       : %v\n", *pointAll)
+	fmt.Fprintf(console, "  Point direction         : %v\n", *pointDirection)
+	if *pointDirection && !*multiPass {
+		fmt.Fprintf(console, "  Node locations          : %s\n", *nodeLocations)
+	}
+	fmt.Fprintf(console, "  Point position          : %v\n", *pointPosition)
+	if *qaRelations != "" {
+		fmt.Fprintf(console, "  Relation QA files       : %s.csv, %s.geojson\n", *qaRelations, *qaRelations)
+	}
+	if *qaPoints != "" {
+		fmt.Fprintf(console, "  Point QA files          : %s.csv, %s.geojson\n", *qaPoints, *qaPoints)
+	}
+	if *statsOutput != "" {
+		fmt.Fprintf(console, "  Statistics file         : %s\n", *statsOutput)
 	}
 
-	nodes, ways, relations := 0, 0, 0
-	stats := newElementStats()
-
-	newNodeID = osm.NodeID(*startNode)
-	junctionPointsFound := 0
-
-	turningCirclePointsFound := 0
-	turningLoopPointsFound := 0
-	turningCircleLoop := make(map[osm.NodeID]*osm.Node)
-	turningCircleLoopModified := 0
-
-	minLat, maxLat := math.MaxFloat64, -math.MaxFloat64
-	minLon, maxLon := math.MaxFloat64, -math.MaxFloat64
-
-	minTS, maxTS := time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC), time.Time{}
-
-	var (
-		maxNodeRefs   int
-		maxNodeRefsID osm.WayID
-	)
-
-	var (
-		maxRelRefs   int
-		maxRelRefsID osm.RelationID
-	)
+	var clip process.Area
+	if *bbox != "" && *polygonFile != "" {
+		log.Fatalf("options bbox and polygon are mutually exclusive")
+	}
+	if *bbox != "" {
+		box, err := process.ParseBBox(*bbox)
+		if err != nil {
+			log.Fatalf("invalid bbox: %v", err)
+		}
+		clip = box
+	}
+	if *polygonFile != "" {
+		polygon, err := process.LoadPolygon(*polygonFile)
+		if err != nil {
+			log.Fatalf("error loading polygon: %v", err)
+		}
+		clip = polygon
+	}
+	if clip != nil {
+		fmt.Fprintf(console, "  Clip area               : %s\n", clip)
+	}
+
+	opts := process.Options{
+		Rules:             rules,
+		NodeIDs:           nodeIDs,
+		Processors:        processors,
+		MultiPass:         *multiPass,
+		Clip:              clip,
+		Deduplicate:       !*outputPerInput && len(inputFiles) > 1,
+		AllLevels:         *allLevels,
+		JunctionNames:     *withNames,
+		RelationJunctions: *relationJunctions,
+		DisplaceDistance:  *displace,
+		PointAll:          *pointAll,
+		PointDirection:    *pointDirection,
+		LocationStore:     *nodeLocations,
+		LocationFile:      *nodeLocationsFile,
+		PointPosition:     *pointPosition,
+		RouteRelationQA:   *qaRelations != "",
+		PointQA:           *qaPoints != "",
+	}
+	if opts.DisplaceDistance > 0 {
+		opts.DisplaceBearings, err = parseBearings(*bearings)
+		if err != nil {
+			log.Fatalf("invalid bearing pattern: %v", err)
+		}
+	}
+	processor, err := process.NewProcessor(opts)
+	if err != nil {
+		log.Fatalf("could not create processor: %v", err)
+	}
 
-	scanner := osmpbf.New(context.Background(), fileInput, 3)
-	defer scanner.Close()
+	total := newStatsReport(strings.Join(inputFiles, ","))
 
-	for scanner.Scan() {
-		var ts time.Time
+	// outputs are finalized after the node ID collision check (IDs of all input files required)
+	var outputs multiNodeWriter
 
-		switch e := scanner.Object().(type) {
-		case *osm.Node:
-			nodes++
-			ts = e.Timestamp
-			stats.Add(e.ElementID(), e.Tags)
+	// combined output for all input files
+	var writer nodeWriter
+	if !*outputPerInput {
+		writer, err = newNodeWriters(outputFiles, inputFiles[0])
+		if err != nil {
+			log.Fatalf("could not create output: %v", err)
+		}
+		outputs = append(outputs, writer)
+	}
 
-			if e.Lat > maxLat {
-				maxLat = e.Lat
-			}
-			if e.Lat < minLat {
-				minLat = e.Lat
+	for _, inputFile := range inputFiles {
+		fileWriter := writer
+		qaRelationsFile, qaPointsFile := *qaRelations, *qaPoints
+		if len(inputFiles) > 1 {
+			fmt.Fprintf(console, "\nInput file %s:\n", inputFile)
+			if qaRelationsFile != "" {
+				qaRelationsFile += "_" + inputBaseName(inputFile)
 			}
-			if e.Lon > maxLon {
-				maxLon = e.Lon
+			if qaPointsFile != "" {
+				qaPointsFile += "_" + inputBaseName(inputFile)
 			}
-			if e.Lon < minLon {
-				minLon = e.Lon
+		}
+		if *outputPerInput {
+			fileWriter, err = newNodeWriters(perInputOutputFiles(outputFiles, inputFile), inputFile)
+			if err != nil {
+				log.Fatalf("could not create output: %v", err)
 			}
+			outputs = append(outputs, fileWriter)
+		}
 
-			tags := e.TagMap()
-			// id := e.ElementID()
-			if len(tags) > 0 {
-				// process node_network objects
-				tagValue, found := tags["network:type"]
-				if found && tagValue == "node_network" {
-					junctionPointsFound++
-					createNewNodeNetworkObject(writer, e)
-				}
-
-				// process turning_circle/loop objects
-				// store all highway=turning_circle/loop objects in a map for further processing
-				tagValue, found = tags["highway"]
-				if found {
-					if tagValue == "turning_circle" {
-						turningCirclePointsFound++
-						turningCircleLoop[e.ID] = e
-						/*
-							fmt.Printf("ObjectID: %v, highway=%v\n", e.ObjectID(), tagValue)
-							fmt.Printf("ElementID: %v, highway=%v\n", e.ElementID(), tagValue)
-							fmt.Printf("FeatureID: %v, highway=%v\n", e.FeatureID(), tagValue)
-							fmt.Printf("NodeID: %v, highway=%v\n", e.ID, tagValue)
-							for key, value := range tags {
-								fmt.Printf("ID: %v, %v = %v\n", e.ElementID(), key, value)
-							}
-						*/
-					}
-					if tagValue == "turning_loop" {
-						turningLoopPointsFound++
-						turningCircleLoop[e.ID] = e
-					}
-				}
-			}
+		report := processInput(processor, inputFile, fileWriter, qaRelationsFile, qaPointsFile)
 
-		case *osm.Way:
-			ways++
-			ts = e.Timestamp
-			stats.Add(e.ElementID(), e.Tags)
+		total.add(report)
+		total.Inputs = append(total.Inputs, report)
+	}
 
-			if l := len(e.Nodes); l > maxNodeRefs {
-				maxNodeRefs = l
-				maxNodeRefsID = e.ID
+	// new node IDs must not collide with the IDs of the input nodes
+	if total.NewNodes.Written > 0 {
+		err = nodeIDs.CheckCollision(total.OSMData.IDRanges["node"])
+		if err != nil {
+			discardErr := outputs.Discard()
+			if discardErr != nil {
+				fmt.Fprintf(console, "error discarding output: %v\n", discardErr)
 			}
+			log.Fatalf("node ID collision (choose other startNode): %v", err)
+		}
+	}
 
-			tags := e.TagMap()
-			if len(tags) > 0 {
-				// add highway type to turning_circle/loop node (a turning object can be part of more than one highway (e.g. residential + footway))
-				tagValue, found := tags["highway"]
-				if found && (tagValue == "residential" || tagValue == "living_street" || tagValue == "unclassified" || tagValue == "service" || tagValue == "track") {
-					turningCircleLoopModified += addHighwayTypeToTurningCircleLoop(e, tags, turningCircleLoop, tagValue)
-				}
-			}
+	err = outputs.Close()
+	if err != nil {
+		log.Fatalf("error writing output file: %v", err)
+	}
 
-		case *osm.Relation:
-			relations++
-			ts = e.Timestamp
-			stats.Add(e.ElementID(), e.Tags)
+	if len(inputFiles) > 1 {
+		printTotalStatistics(total, opts)
+	}
 
-			if l := len(e.Members); l > maxRelRefs {
-				maxRelRefs = l
-				maxRelRefsID = e.ID
-			}
+	if *idMappingFile != "" {
+		err = writeIDMapping(*idMappingFile, nodeIDs.Mapping)
+		if err != nil {
+			log.Fatalf("error writing ID mapping file: %v", err)
 		}
+		fmt.Fprintf(console, "\nID mapping:\n")
+		fmt.Fprintf(console, "  IDs reused              : %v\n", nodeIDs.Mapping.Reused)
+		fmt.Fprintf(console, "  Entries not used (kept) : %v\n", nodeIDs.Mapping.Unused())
+		fmt.Fprintf(console, "  Entries written         : %v\n", nodeIDs.Mapping.Len())
+	}
 
-		if ts.After(maxTS) {
-			maxTS = ts
+	if *statsOutput != "" {
+		report := total
+		if len(inputFiles) == 1 {
+			report = total.Inputs[0]
 		}
-
-		if ts.Before(minTS) {
-			minTS = ts
+		err = writeStatsFile(*statsOutput, report)
+		if err != nil {
+			log.Fatalf("error writing statistics file: %v", err)
 		}
 	}
 
-	if err := scanner.Err(); err != nil {
-		fmt.Printf("scanner returned error: %v", err)
-		os.Exit(1)
-	}
-
-	fmt.Printf("\nJunction point statistics:\n")
-	fmt.Printf("  Points found            : %v\n", junctionPointsFound)
+	fmt.Fprintf(console, "\n")
+	os.Exit(0)
+}
 
-	fmt.Printf("\nNew nodes created:\n")
-	fmt.Printf("  Nodes written           : %v\n", (int(newNodeID) - *startNode))
+/*
+processInput processes one OSM input file (new and modified nodes are written to writer)
+*/
+func processInput(processor *process.Processor, inputFile string, writer nodeWriter, qaRelations, qaPoints string) *statsReport {
+	inputFormat := ""
+	open := func() (osm.Scanner, error) {
+		scanner, format, err := openInputScanner(inputFile)
+		if err == nil && inputFormat == "" {
+			inputFormat = format
+			fmt.Fprintf(console, "  OSM input format        : %s\n", inputFormat)
+		}
+		return scanner, err
+	}
 
-	fmt.Printf("\nTurning circle/loop point statistics:\n")
-	fmt.Printf("  turning_circle found    : %v\n", turningCirclePointsFound)
-	fmt.Printf("  turning_loop found      : %v\n", turningLoopPointsFound)
-	fmt.Printf("  turning objects total   : %v\n", len(turningCircleLoop))
-	fmt.Printf("  highway types added     : %v\n", turningCircleLoopModified)
-	// build statistic
-	turningStatistic := make(map[string]int)
-	for _, value := range turningCircleLoop {
-		// check if "fzk_turning" tag exists
-		fzkTagFound := false
-		for _, tag := range value.Tags {
-			if tag.Key == "fzk_turning" {
-				turningStatistic[tag.Value]++
-				fzkTagFound = true
-				break
-			}
+	var result *process.Result
+	if processor.Options().MultiPass {
+		// input is reopened for each pass
+		var err error
+		result, err = processor.RunPasses(open, writer)
+		if err != nil {
+			fmt.Fprintf(console, "%v", err)
+			os.Exit(1)
 		}
-		if fzkTagFound == false {
-			turningStatistic["not_set"]++
-		}
-	}
-	for key, value := range turningStatistic {
-		fmt.Printf("  %-23s : %v\n", key, value)
-	}
-
-	fmt.Printf("\nOSM data statistics:\n")
-	fmt.Printf("  Timestamp min           : %v\n", minTS.Format(time.RFC3339))
-	fmt.Printf("  Timestamp max           : %v\n", maxTS.Format(time.RFC3339))
-	fmt.Printf("  Lon min                 : %0.7f\n", minLon)
-	fmt.Printf("  Lon max                 : %0.7f\n", maxLon)
-	fmt.Printf("  Lat min                 : %0.7f\n", minLat)
-	fmt.Printf("  Lat max                 : %0.7f\n", maxLat)
-	fmt.Printf("  Nodes                   : %v\n", nodes)
-	fmt.Printf("  Ways                    : %v\n", ways)
-	fmt.Printf("  Relations               : %v\n", relations)
-	fmt.Printf("  Version max             : %v\n", stats.MaxVersion)
-	fmt.Printf("  Node ID min             : %v\n", stats.Ranges[osm.TypeNode].Min)
-	fmt.Printf("  Node ID max             : %v\n", stats.Ranges[osm.TypeNode].Max)
-	fmt.Printf("  Way ID min              : %v\n", stats.Ranges[osm.TypeWay].Min)
-	fmt.Printf("  Way ID max              : %v\n", stats.Ranges[osm.TypeWay].Max)
-	fmt.Printf("  Relation ID min         : %v\n", stats.Ranges[osm.TypeRelation].Min)
-	fmt.Printf("  Relation ID max         : %v\n", stats.Ranges[osm.TypeRelation].Max)
-	fmt.Printf("  Keyval pairs max        : %v\n", stats.MaxTags)
-	fmt.Printf("  Keyval pairs max object : %v %v\n", stats.MaxTagsID.Type(), stats.MaxTagsID.Ref())
-	fmt.Printf("  Noderefs max            : %v\n", maxNodeRefs)
-	fmt.Printf("  Noderefs max object     : way %v\n", maxNodeRefsID)
-	fmt.Printf("  Relrefs max             : %v\n", maxRelRefs)
-	fmt.Printf("  Relrefs max object      : relation %v\n", maxRelRefsID)
-
-	// write/duplicate turning_circle/loop objects (with unmodified ID)
-	for _, value := range turningCircleLoop {
-		// check if "fzk_turning" tag exists
-		fzkTagFound := false
-		for _, tag := range value.Tags {
-			if tag.Key == "fzk_turning" {
-				fzkTagFound = true
-				break
-			}
+	} else {
+		scanner, err := open()
+		if err != nil {
+			log.Fatalf("%v", err)
 		}
-		if fzkTagFound == false {
-			// add tag "fzk_turning=not_set"
-			freizeitkarteTag := osm.Tag{Key: "fzk_turning", Value: "not_set"}
-			value.Tags = append(value.Tags, freizeitkarteTag)
+		result, err = processor.Run(scanner, writer)
+		if err != nil {
+			fmt.Fprintf(console, "%v", err)
+			os.Exit(1)
 		}
-
-		data, err := xml.MarshalIndent(value, "  ", "  ")
+		err = scanner.Close()
 		if err != nil {
-			log.Fatalf("error <%v> at xml.MarshalIndent()", err)
+			log.Fatalf("could not close file: %v", err)
 		}
+	}
+	report := newStatsReport(inputFile)
+	report.InputFormat = inputFormat
+	report.Result = *result
 
-		_, err = fmt.Fprintf(writer, "%s\n", string(data))
+	printStatistics(result, processor.Options())
+
+	if result.RouteRelations != nil {
+		err := writeRouteRelationQA(qaRelations, result.RouteRelationMismatches)
 		if err != nil {
-			log.Fatalf("error writing output file: %v", err)
+			log.Fatalf("error writing route relation QA files: %v", err)
 		}
 	}
-
-	_, err = fmt.Fprintf(writer, "</osm>\n")
-	if err != nil {
-		log.Fatalf("error writing file: %v", err)
+	if qaPoints != "" {
+		err := writePointQA(qaPoints, result.PointIssues)
+		if err != nil {
+			log.Fatalf("error writing point object QA files: %v", err)
+		}
 	}
-	err = writer.Flush()
-	if err != nil {
-		log.Fatalf("could not flush file buffer: %v", err)
+
+	return report
+}
+
+/*
+printStatistics prints statistics of one input file
+*/
+func printStatistics(result *process.Result, opts process.Options) {
+	if isProcessor(opts, process.StepNodeNetwork) {
+		junctions := result.Junctions
+		fmt.Fprintf(console, "\nJunction point statistics:\n")
+		fmt.Fprintf(console, "  Points found            : %v\n", junctions.PointsFound)
+		if opts.DisplaceDistance > 0 {
+			fmt.Fprintf(console, "  Nodes displaced         : %v\n", junctions.NodesDisplaced)
+		}
+		if opts.RelationJunctions {
+			fmt.Fprintf(console, "  Relation candidates     : %v\n", junctions.RelationCandidates)
+			fmt.Fprintf(console, "  Relation points found   : %v\n", junctions.RelationPointsFound)
+		}
+		// print network levels in hierarchical order, followed by unknown levels (sorted)
+		for _, level := range process.NetworkLevels {
+			if count, found := junctions.Levels[level]; found {
+				fmt.Fprintf(console, "  %-23s : %v\n", level, count)
+			}
+		}
+		unknownLevels := []string{}
+		for level := range junctions.Levels {
+			if !process.IsNetworkLevel(level) {
+				unknownLevels = append(unknownLevels, level)
+			}
+		}
+		sort.Strings(unknownLevels)
+		for _, level := range unknownLevels {
+			fmt.Fprintf(console, "  %-23s : %v\n", level, junctions.Levels[level])
+		}
 	}
-	err = fileOutput.Close()
-	if err != nil {
-		log.Fatalf("could not close file: %v", err)
+
+	if result.RouteRelations != nil {
+		fmt.Fprintf(console, "\nRoute relation validation:\n")
+		fmt.Fprintf(console, "  Junctions checked       : %v\n", result.RouteRelations.JunctionsChecked)
+		fmt.Fprintf(console, "  Mismatches found        : %v\n", result.RouteRelations.Mismatches)
 	}
-	err = fileInput.Close()
-	if err != nil {
-		log.Fatalf("could not close file: %v", err)
+
+	fmt.Fprintf(console, "\nNew nodes created:\n")
+	fmt.Fprintf(console, "  Nodes written           : %v\n", result.NewNodes.Written)
+
+	if result.Duplicates != nil {
+		fmt.Fprintf(console, "\nDuplicates skipped (written for earlier input):\n")
+		fmt.Fprintf(console, "  New nodes               : %v\n", result.Duplicates.NewNodes)
+		fmt.Fprintf(console, "  Modified nodes          : %v\n", result.Duplicates.ModifiedNodes)
 	}
 
-	fmt.Printf("\n")
-	os.Exit(0)
-}
+	if result.Clip != nil {
+		printClipStatistics(result.Clip)
+	}
 
-// elementStats is a shared bit of code to accumulate stats from the element ids.
-type elementStats struct {
-	Ranges     map[osm.Type]*idRange
-	MaxVersion int
-	MaxTags    int
-	MaxTagsID  osm.ElementID
-}
+	for i, ps := range result.Points {
+		rule := opts.Rules.PointEnrichments[i]
+		fmt.Fprintf(console, "\n%s point statistics:\n", ps.Name)
+		for _, selector := range rule.NodeTags {
+			fmt.Fprintf(console, "  %-23s : %v\n", selector.Label()+" found", ps.Found[selector.Label()])
+		}
+		fmt.Fprintf(console, "  objects total           : %v\n", ps.Total)
+		fmt.Fprintf(console, "  %-23s : %v\n", rule.WayKey+" types added", ps.TypesAdded)
+		fmt.Fprintf(console, "  %-23s : %v\n", rule.WayKey+" types replaced", ps.TypesReplaced)
+		if opts.PointDirection {
+			fmt.Fprintf(console, "  directions added        : %v\n", ps.DirectionsAdded)
+		}
+		if ps.Positions != nil {
+			fmt.Fprintf(console, "  position end of way     : %v\n", ps.Positions[process.PositionEnd])
+			fmt.Fprintf(console, "  position mid-way        : %v\n", ps.Positions[process.PositionMiddle])
+			fmt.Fprintf(console, "  position orphan         : %v\n", ps.Positions[process.PositionOrphan])
+		}
+		for key, value := range ps.Classes {
+			fmt.Fprintf(console, "  %-23s : %v\n", key, value)
+		}
+	}
 
-// idRange defines min and max ID value
-type idRange struct {
-	Min, Max int64
+	data := result.OSMData
+	fmt.Fprintf(console, "\nOSM data statistics:\n")
+	fmt.Fprintf(console, "  Timestamp min           : %v\n", data.TimestampMin.Format(time.RFC3339))
+	fmt.Fprintf(console, "  Timestamp max           : %v\n", data.TimestampMax.Format(time.RFC3339))
+	fmt.Fprintf(console, "  Lon min                 : %0.7f\n", data.LonMin)
+	fmt.Fprintf(console, "  Lon max                 : %0.7f\n", data.LonMax)
+	fmt.Fprintf(console, "  Lat min                 : %0.7f\n", data.LatMin)
+	fmt.Fprintf(console, "  Lat max                 : %0.7f\n", data.LatMax)
+	fmt.Fprintf(console, "  Nodes                   : %v\n", data.Nodes)
+	fmt.Fprintf(console, "  Ways                    : %v\n", data.Ways)
+	fmt.Fprintf(console, "  Relations               : %v\n", data.Relations)
+	fmt.Fprintf(console, "  Version max             : %v\n", data.VersionMax)
+	fmt.Fprintf(console, "  Node ID min             : %v\n", data.IDRanges["node"].Min)
+	fmt.Fprintf(console, "  Node ID max             : %v\n", data.IDRanges["node"].Max)
+	fmt.Fprintf(console, "  Way ID min              : %v\n", data.IDRanges["way"].Min)
+	fmt.Fprintf(console, "  Way ID max              : %v\n", data.IDRanges["way"].Max)
+	fmt.Fprintf(console, "  Relation ID min         : %v\n", data.IDRanges["relation"].Min)
+	fmt.Fprintf(console, "  Relation ID max         : %v\n", data.IDRanges["relation"].Max)
+	fmt.Fprintf(console, "  Keyval pairs max        : %v\n", data.KeyvalPairsMax)
+	fmt.Fprintf(console, "  Keyval pairs max object : %v %v\n", data.KeyvalPairsMaxObject.Type, data.KeyvalPairsMaxObject.ID)
+	fmt.Fprintf(console, "  Noderefs max            : %v\n", data.NoderefsMax)
+	fmt.Fprintf(console, "  Noderefs max object     : %v %v\n", data.NoderefsMaxObject.Type, data.NoderefsMaxObject.ID)
+	fmt.Fprintf(console, "  Relrefs max             : %v\n", data.RelrefsMax)
+	fmt.Fprintf(console, "  Relrefs max object      : %v %v\n", data.RelrefsMaxObject.Type, data.RelrefsMaxObject.ID)
 }
 
 /*
-newElementStats creates new elements static map
+printClipStatistics prints counts before and after clipping and extent of kept nodes
 */
-func newElementStats() *elementStats {
-	return &elementStats{
-		Ranges: map[osm.Type]*idRange{
-			osm.TypeNode:     {Min: math.MaxInt64},
-			osm.TypeWay:      {Min: math.MaxInt64},
-			osm.TypeRelation: {Min: math.MaxInt64},
-		},
+func printClipStatistics(clip *process.ClipStats) {
+	fmt.Fprintf(console, "\nClipping statistics:\n")
+	fmt.Fprintf(console, "  Area                    : %s\n", clip.Area)
+	fmt.Fprintf(console, "  New nodes before        : %v\n", clip.NewNodesBefore)
+	fmt.Fprintf(console, "  New nodes after         : %v\n", clip.NewNodesAfter)
+	fmt.Fprintf(console, "  Modified nodes before   : %v\n", clip.ModifiedNodesBefore)
+	fmt.Fprintf(console, "  Modified nodes after    : %v\n", clip.ModifiedNodesAfter)
+	if clip.NewNodesAfter+clip.ModifiedNodesAfter > 0 {
+		fmt.Fprintf(console, "  Lon min                 : %0.7f\n", clip.LonMin)
+		fmt.Fprintf(console, "  Lon max                 : %0.7f\n", clip.LonMax)
+		fmt.Fprintf(console, "  Lat min                 : %0.7f\n", clip.LatMin)
+		fmt.Fprintf(console, "  Lat max                 : %0.7f\n", clip.LatMax)
 	}
 }
 
 /*
-Add adds max version and max tags
+printTotalStatistics prints total statistics of all input files
 */
-func (s *elementStats) Add(id osm.ElementID, tags osm.Tags) {
-	s.Ranges[id.Type()].Add(id.Ref())
-	if v := id.Version(); v > s.MaxVersion {
-		s.MaxVersion = v
-	}
-	if l := len(tags); l > s.MaxTags {
-		s.MaxTags = l
-		s.MaxTagsID = id
-	}
+func printTotalStatistics(total *statsReport, opts process.Options) {
+	fmt.Fprintf(console, "\nTotal statistics (%d input files):\n", len(total.Inputs))
+	if isProcessor(opts, process.StepNodeNetwork) {
+		fmt.Fprintf(console, "  Junction points found   : %v\n", total.Junctions.PointsFound)
+	}
+	if opts.RelationJunctions {
+		fmt.Fprintf(console, "  Relation points found   : %v\n", total.Junctions.RelationPointsFound)
+	}
+	if total.RouteRelations != nil {
+		fmt.Fprintf(console, "  Relation mismatches     : %v\n", total.RouteRelations.Mismatches)
+	}
+	fmt.Fprintf(console, "  New nodes written       : %v\n", total.NewNodes.Written)
+	for _, ps := range total.Points {
+		fmt.Fprintf(console, "  %-23s : %v\n", ps.Name, ps.Total)
+	}
+	if total.Duplicates != nil {
+		fmt.Fprintf(console, "  New nodes skipped       : %v\n", total.Duplicates.NewNodes)
+		fmt.Fprintf(console, "  Modified nodes skipped  : %v\n", total.Duplicates.ModifiedNodes)
+	}
+	if total.Clip != nil {
+		fmt.Fprintf(console, "  New nodes clipped       : %v\n", total.Clip.NewNodesBefore-total.Clip.NewNodesAfter)
+		fmt.Fprintf(console, "  Modified nodes clipped  : %v\n", total.Clip.ModifiedNodesBefore-total.Clip.ModifiedNodesAfter)
+	}
+	fmt.Fprintf(console, "  Nodes                   : %v\n", total.OSMData.Nodes)
+	fmt.Fprintf(console, "  Ways                    : %v\n", total.OSMData.Ways)
+	fmt.Fprintf(console, "  Relations               : %v\n", total.OSMData.Relations)
+	fmt.Fprintf(console, "  Node ID min             : %v\n", total.OSMData.IDRanges["node"].Min)
+	fmt.Fprintf(console, "  Node ID max             : %v\n", total.OSMData.IDRanges["node"].Max)
 }
 
 /*
-Add adds min or max ID
+parseProcessors parses comma separated list of processing steps (all steps prefixed with '-': default steps without these)
 */
-func (r *idRange) Add(ref int64) {
-	if ref > r.Max {
-		r.Max = ref
-	}
-	if ref < r.Min {
-		r.Min = ref
+func parseProcessors(list string) ([]string, error) {
+	if strings.TrimSpace(list) == "" {
+		return process.StepNames(), nil
 	}
-}
 
-/*
-createNewNodeNetworkObject creates new node_network object
-<node id="355939532" lat="52.2220383" lon="7.022982600000001" user="" uid="0" visible="true" version="8" changeset="0" timestamp="2019-09-13T06:50:45Z">
-  <tag k="expected_rcn_route_relations" v="3"></tag>
-  <tag k="network:type" v="node_network"></tag>
-  <tag k="rcn:name" v="Spechtholtshook"></tag>
-  <tag k="rcn_ref" v="53"></tag>
-  <tag k="rwn_ref" v="X32"></tag>
-</node>
-... will be transformed to:
-<node id="xxxxxxx001" lat="52.2220383" lon="7.022982600000001" user="" uid="0" visible="true" version="8" changeset="0" timestamp="2019-09-13T06:50:45Z">
-  <tag k="node_network" v="node_bicycle"></tag>
-  <tag k="name" v="53"></tag>
-</node>
-<node id="xxxxxxx002" lat="52.2220383" lon="7.022982600000001" user="" uid="0" visible="true" version="8" changeset="0" timestamp="2019-09-13T06:50:45Z">
-  <tag k="node_network" v="node_hiking"></tag>
-  <tag k="name" v="X32"></tag>
-</node>
-*/
-func createNewNodeNetworkObject(writer *bufio.Writer, sourceOsmNode *osm.Node) {
-	tags := sourceOsmNode.TagMap()
-
-	// Punktnetzwerk 'Fahrrad'
-	newOsmNode := *sourceOsmNode // copy content (don't modify origin/source node)
-	newOsmNode.ID = 0
-	newOsmNode.Tags = []osm.Tag{} // remove all source tags
-	refValue, found := tags["icn_ref"]
-	if found {
-		tag := osm.Tag{Key: "node_network", Value: "node_bicycle"}
-		newOsmNode.Tags = append(newOsmNode.Tags, tag)
-		tag = osm.Tag{Key: "name", Value: refValue}
-		newOsmNode.Tags = append(newOsmNode.Tags, tag)
-		writeNewNodeObject(writer, &newOsmNode)
-	} else {
-		refValue, found = tags["ncn_ref"]
-		if found {
-			tag := osm.Tag{Key: "node_network", Value: "node_bicycle"}
-			newOsmNode.Tags = append(newOsmNode.Tags, tag)
-			tag = osm.Tag{Key: "name", Value: refValue}
-			newOsmNode.Tags = append(newOsmNode.Tags, tag)
-			writeNewNodeObject(writer, &newOsmNode)
+	selected := []string{}
+	disabled := make(map[string]bool)
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if strings.HasPrefix(item, "-") {
+			disabled[strings.TrimPrefix(item, "-")] = true
 		} else {
-			refValue, found = tags["rcn_ref"]
-			if found {
-				tag := osm.Tag{Key: "node_network", Value: "node_bicycle"}
-				newOsmNode.Tags = append(newOsmNode.Tags, tag)
-				tag = osm.Tag{Key: "name", Value: refValue}
-				newOsmNode.Tags = append(newOsmNode.Tags, tag)
-				writeNewNodeObject(writer, &newOsmNode)
-			} else {
-				refValue, found = tags["lcn_ref"]
-				if found {
-					tag := osm.Tag{Key: "node_network", Value: "node_bicycle"}
-					newOsmNode.Tags = append(newOsmNode.Tags, tag)
-					tag = osm.Tag{Key: "name", Value: refValue}
-					newOsmNode.Tags = append(newOsmNode.Tags, tag)
-					writeNewNodeObject(writer, &newOsmNode)
-				}
-			}
+			selected = append(selected, item)
 		}
 	}
+	if len(selected) > 0 && len(disabled) > 0 {
+		return nil, fmt.Errorf("'%s' mixes selected and disabled steps", list)
+	}
+	if len(selected) > 0 {
+		return selected, nil
+	}
 
-	// Punktnetzwerk 'Wandern'
-	newOsmNode = *sourceOsmNode // copy content (don't modify origin/source node)
-	newOsmNode.ID = 0
-	newOsmNode.Tags = []osm.Tag{} // remove all source tags
-	refValue, found = tags["iwn_ref"]
-	if found {
-		tag := osm.Tag{Key: "node_network", Value: "node_hiking"}
-		newOsmNode.Tags = append(newOsmNode.Tags, tag)
-		tag = osm.Tag{Key: "name", Value: refValue}
-		newOsmNode.Tags = append(newOsmNode.Tags, tag)
-		writeNewNodeObject(writer, &newOsmNode)
-	} else {
-		refValue, found = tags["nwn_ref"]
-		if found {
-			tag := osm.Tag{Key: "node_network", Value: "node_hiking"}
-			newOsmNode.Tags = append(newOsmNode.Tags, tag)
-			tag = osm.Tag{Key: "name", Value: refValue}
-			newOsmNode.Tags = append(newOsmNode.Tags, tag)
-			writeNewNodeObject(writer, &newOsmNode)
+	for _, name := range process.StepNames() {
+		if disabled[name] {
+			delete(disabled, name)
 		} else {
-			refValue, found = tags["rwn_ref"]
-			if found {
-				tag := osm.Tag{Key: "node_network", Value: "node_hiking"}
-				newOsmNode.Tags = append(newOsmNode.Tags, tag)
-				tag = osm.Tag{Key: "name", Value: refValue}
-				newOsmNode.Tags = append(newOsmNode.Tags, tag)
-				writeNewNodeObject(writer, &newOsmNode)
-			} else {
-				refValue, found = tags["lwn_ref"]
-				if found {
-					tag := osm.Tag{Key: "node_network", Value: "node_hiking"}
-					newOsmNode.Tags = append(newOsmNode.Tags, tag)
-					tag = osm.Tag{Key: "name", Value: refValue}
-					newOsmNode.Tags = append(newOsmNode.Tags, tag)
-					writeNewNodeObject(writer, &newOsmNode)
-				}
-			}
+			selected = append(selected, name)
 		}
 	}
-
-	// Punktnetzwerk 'Inline-Skaten'
-	newOsmNode = *sourceOsmNode // copy content (don't modify origin/source node)
-	newOsmNode.ID = 0
-	newOsmNode.Tags = []osm.Tag{} // remove all source tags
-	refValue, found = tags["rin_ref"]
-	if found {
-		tag := osm.Tag{Key: "node_network", Value: "node_inline_skates"}
-		newOsmNode.Tags = append(newOsmNode.Tags, tag)
-		tag = osm.Tag{Key: "name", Value: refValue}
-		newOsmNode.Tags = append(newOsmNode.Tags, tag)
-		writeNewNodeObject(writer, &newOsmNode)
-	}
-
-	// Punktnetzwerk 'Reiten'
-	newOsmNode = *sourceOsmNode // copy content (don't modify origin/source node)
-	newOsmNode.ID = 0
-	newOsmNode.Tags = []osm.Tag{} // remove all source tags
-	refValue, found = tags["rhn_ref"]
-	if found {
-		tag := osm.Tag{Key: "node_network", Value: "node_horse"}
-		newOsmNode.Tags = append(newOsmNode.Tags, tag)
-		tag = osm.Tag{Key: "name", Value: refValue}
-		newOsmNode.Tags = append(newOsmNode.Tags, tag)
-		writeNewNodeObject(writer, &newOsmNode)
-	}
-
-	// Punktnetzwerk 'Kanu'
-	newOsmNode = *sourceOsmNode // copy content (don't modify origin/source node)
-	newOsmNode.ID = 0
-	newOsmNode.Tags = []osm.Tag{} // remove all source tags
-	refValue, found = tags["rpn_ref"]
-	if found {
-		tag := osm.Tag{Key: "node_network", Value: "node_canoe"}
-		newOsmNode.Tags = append(newOsmNode.Tags, tag)
-		tag = osm.Tag{Key: "name", Value: refValue}
-		newOsmNode.Tags = append(newOsmNode.Tags, tag)
-		writeNewNodeObject(writer, &newOsmNode)
-	}
-
-	// Punktnetzwerk 'Motorboot'
-	newOsmNode = *sourceOsmNode // copy content (don't modify origin/source node)
-	newOsmNode.ID = 0
-	newOsmNode.Tags = []osm.Tag{} // remove all source tags
-	refValue, found = tags["rmn_ref"]
-	if found {
-		tag := osm.Tag{Key: "node_network", Value: "node_motorboat"}
-		newOsmNode.Tags = append(newOsmNode.Tags, tag)
-		tag = osm.Tag{Key: "name", Value: refValue}
-		newOsmNode.Tags = append(newOsmNode.Tags, tag)
-		writeNewNodeObject(writer, &newOsmNode)
+	for name := range disabled {
+		return nil, fmt.Errorf("unknown processing step '%s'", name)
 	}
+	return selected, nil
 }
 
 /*
-writeNewNodeObject writes node object to file
+isProcessor checks if processing step is selected
 */
-func writeNewNodeObject(writer *bufio.Writer, newOsmNode *osm.Node) {
-	newOsmNode.ID = newNodeID
-	newNodeID++
-
-	data, err := xml.MarshalIndent(newOsmNode, "  ", "  ")
-	if err != nil {
-		log.Fatalf("error <%v> at xml.MarshalIndent()", err)
-	}
-	_, err = fmt.Fprintf(writer, "%s\n", string(data))
-	if err != nil {
-		log.Fatalf("error writing output file: %v", err)
+func isProcessor(opts process.Options, name string) bool {
+	for _, processor := range opts.Processors {
+		if processor == name {
+			return true
+		}
 	}
+	return false
 }
 
 /*
-addHighwayTypeToTurningCycleLoop adds highway type to turning_cylce/loop node (if such node exists)
+parseBearings parses comma separated list of bearings (degrees)
 */
-func addHighwayTypeToTurningCircleLoop(e *osm.Way, tags map[string]string, turningCircleLoop map[osm.NodeID]*osm.Node, highwayType string) int {
-	found := 0
-	/*
-		fmt.Printf("\nID: %v, nodes = %v\n", e.ElementID(), len(e.Nodes))
-		for key, value := range tags {
-			fmt.Printf("ID: %v, %v = %v\n", e.ElementID(), key, value)
-		}
-	*/
-	for _, node := range e.Nodes {
-		// fmt.Printf("ID: %v, node = %v\n", e.ElementID(), node.ID)
-		// try to find turning_circle/loop for each node (do not break loop processing)
-		// add street type as special Freizeitkarte tag (e.g. "fzk_turning=living_street")
-		freizeitkarteTagFound := false
-		if value, ok := turningCircleLoop[node.ID]; ok {
-			// check if Freizeitkarte tag already exists
-			for _, tag := range value.Tags {
-				if tag.Key == "fzk_turning" {
-					freizeitkarteTagFound = true
-					break
-				}
-			}
-			if freizeitkarteTagFound == false {
-				freizeitkarteTag := osm.Tag{Key: "fzk_turning", Value: highwayType}
-				value.Tags = append(value.Tags, freizeitkarteTag)
-				// fmt.Printf("turning_circle/loop found: key = %v, value = %#v\n", node.ID, value)
-				found++
-			}
+func parseBearings(list string) ([]float64, error) {
+	bearings := []float64{}
+	for _, item := range strings.Split(list, ",") {
+		bearing, err := strconv.ParseFloat(strings.TrimSpace(item), 64)
+		if err != nil {
+			return nil, err
 		}
+		bearings = append(bearings, bearing)
 	}
-
-	return found
+	return bearings, nil
 }
 
 /*
-printProgUsage prints program usage.
+printProgUsage prints program usage (to stderr).
 */
 func printProgUsage() {
-	fmt.Printf("\nUsage:\n")
-	fmt.Printf("  %s -inputOSM=filename -outputNodes=filename -startNode=number\n", progName)
-	fmt.Printf("\nExample:\n")
-	fmt.Printf("  %s -inputOSM=osmdata.pbf -outputNodes=osmpp.xml -startNode=1000000000000\n", progName)
-	fmt.Printf("\nOptions:\n")
+	fmt.Fprintf(os.Stderr, "\nUsage:\n")
+	fmt.Fprintf(os.Stderr, "  %s -inputOSM=filename -outputNodes=filename -startNode=number|auto|negative\n", progName)
+	fmt.Fprintf(os.Stderr, "\nExample:\n")
+	fmt.Fprintf(os.Stderr, "  %s -inputOSM=osmdata.pbf -outputNodes=osmpp.xml -startNode=1000000000000\n", progName)
+	fmt.Fprintf(os.Stderr, "\nOptions:\n")
 	flag.PrintDefaults()
 
 	os.Exit(1)
 }
-
-/*
-duplicateNetworkJunctionPoint duplicates node from junction point network.
-<node id="355939532" lat="52.2220383" lon="7.022982600000001" user="" uid="0" visible="true" version="8" changeset="0" timestamp="2019-09-13T06:50:45Z">
-  <tag k="expected_rcn_route_relations" v="3"></tag>
-  <tag k="network:type" v="node_network"></tag>
-  <tag k="rcn:name" v="Spechtholtshook"></tag>
-  <tag k="rcn_ref" v="53"></tag>
-  <tag k="rwn_ref" v="X32"></tag>
-</node>
-... will be transformed to:
-<node id="xxxxxxx001" lat="52.2220383" lon="7.022982600000001" user="" uid="0" visible="true" version="8" changeset="0" timestamp="2019-09-13T06:50:45Z">
-  <tag k="fzk_network:type" v="node_network"></tag>
-  <tag k="rcn_ref" v="53"></tag>
-  <tag k="name" v="Spechtholtshook"></tag>
-</node>
-<node id="xxxxxxx002" lat="52.2220383" lon="7.022982600000001" user="" uid="0" visible="true" version="8" changeset="0" timestamp="2019-09-13T06:50:45Z">
-  <tag k="fzk_network:type" v="fzk_network:type"></tag>
-  <tag k="rwn_ref" v="X32"></tag>
-  <tag k="name" v="Spechtholtshook"></tag>
-</node>
-*/
-/*
-func duplicateNetworkJunctionPoint(writer *bufio.Writer, sourceOsmNode *osm.Node, nodeID osm.NodeID, refKey, refValue, nameKey, nameValue string) {
-	newOsmNode := *sourceOsmNode // copy content (don't modify origin/source node)
-	newOsmNode.ID = nodeID
-	newOsmNode.Tags = []osm.Tag{}
-
-	tag := osm.Tag{Key: "fzk_network:type", Value: "node_network"}
-	newOsmNode.Tags = append(newOsmNode.Tags, tag)
-
-	tag.Key = refKey
-	tag.Value = refValue
-	newOsmNode.Tags = append(newOsmNode.Tags, tag)
-
-	if nameValue != "" {
-		tag.Key = nameKey
-		tag.Value = nameValue
-		newOsmNode.Tags = append(newOsmNode.Tags, tag)
-	}
-
-	data, err := xml.MarshalIndent(newOsmNode, "  ", "  ")
-	if err != nil {
-		log.Fatalf("error <%v> at xml.MarshalIndent()", err)
-	}
-
-	_, err = fmt.Fprintf(writer, "%s\n", string(data))
-	if err != nil {
-		log.Fatalf("error writing output file: %v", err)
-	}
-}
-*/
-
-/*
-	nameKey := "rcn:name"
-	nameValue, _ := tags[nameKey]
-
-	refKey := "rcn_ref" // cycling
-	refValue, found := tags[refKey]
-	if found {
-		duplicateNetworkJunctionPoint(writer, e, nodeID, refKey, refValue, nameKey, nameValue)
-		nodeID++
-		junctionPointsWritten++
-	}
-
-	refKey = "rwn_ref" // walking
-	refValue, found = tags[refKey]
-	if found {
-		duplicateNetworkJunctionPoint(writer, e, nodeID, refKey, refValue, nameKey, nameValue)
-		nodeID++
-		junctionPointsWritten++
-	}
-
-	refKey = "rin_ref" // inline skating
-	refValue, found = tags[refKey]
-	if found {
-		duplicateNetworkJunctionPoint(writer, e, nodeID, refKey, refValue, nameKey, nameValue)
-		nodeID++
-		junctionPointsWritten++
-	}
-
-	refKey = "rhn_ref" // horse riding
-	refValue, found = tags[refKey]
-	if found {
-		duplicateNetworkJunctionPoint(writer, e, nodeID, refKey, refValue, nameKey, nameValue)
-		nodeID++
-		junctionPointsWritten++
-	}
-
-	refKey = "rpn_ref" // canoeing
-	refValue, found = tags[refKey]
-	if found {
-		duplicateNetworkJunctionPoint(writer, e, nodeID, refKey, refValue, nameKey, nameValue)
-		nodeID++
-		junctionPointsWritten++
-	}
-
-	refKey = "rmn_ref" // motorboat driving
-	refValue, found = tags[refKey]
-	if found {
-		duplicateNetworkJunctionPoint(writer, e, nodeID, refKey, refValue, nameKey, nameValue)
-		nodeID++
-		junctionPointsWritten++
-	}
-*/
@@ -0,0 +1,109 @@
+/*
+Purpose:
+- ID selection for new nodes
+
+Description:
+- number   : new node IDs start at the given ID (ascending)
+- auto     : new node IDs start above the maximum node ID of all input files (rounded up to the next
+             multiple of autoStartNodeStep), requires a first pass over the nodes of the input files
+- negative : new node IDs are negative (-1, -2, ...), as used for new objects in editors
+- The ID scheme (sequential, source) is implemented in package process.
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/paulmach/osm"
+)
+
+// special values of startNode option
+const (
+	startNodeAuto     = "auto"
+	startNodeNegative = "negative"
+)
+
+// automatic start ID is rounded up to a multiple of this value
+const autoStartNodeStep = 1000000
+
+/*
+parseStartNode returns first new node ID and ID step for startNode option
+*/
+func parseStartNode(value string, inputFiles []string) (osm.NodeID, osm.NodeID, error) {
+	switch value {
+	case startNodeNegative:
+		return -1, -1, nil
+	case startNodeAuto:
+		maxID, err := maxInputNodeID(inputFiles)
+		if err != nil {
+			return 0, 0, err
+		}
+		return autoStartNode(maxID), 1, nil
+	}
+
+	startNode, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || startNode <= 0 {
+		return 0, 0, fmt.Errorf("'%s' is neither a positive number nor '%s' or '%s'", value, startNodeAuto, startNodeNegative)
+	}
+	return osm.NodeID(startNode), 1, nil
+}
+
+/*
+autoStartNode returns start ID above maximum node ID (rounded up to multiple of autoStartNodeStep)
+*/
+func autoStartNode(maxID int64) osm.NodeID {
+	if maxID < 0 {
+		maxID = 0
+	}
+	return osm.NodeID((maxID/autoStartNodeStep + 1) * autoStartNodeStep)
+}
+
+/*
+maxInputNodeID reads all input files and returns maximum node ID
+*/
+func maxInputNodeID(inputFiles []string) (int64, error) {
+	var maxID int64
+	for _, inputFile := range inputFiles {
+		if inputFile == stdioFilename {
+			return 0, fmt.Errorf("startNode '%s' requires input file (input is read twice, not possible with stdin)", startNodeAuto)
+		}
+		fileInput, err := openInput(inputFile)
+		if err != nil {
+			return 0, fmt.Errorf("could not open file: %v", err)
+		}
+		scanner, _, err := newOSMScanner(context.Background(), fileInput, inputFile)
+		if err != nil {
+			fileInput.Close()
+			return 0, fmt.Errorf("could not create scanner: %v", err)
+		}
+		// nodes precede ways and relations (reading stops at first way or relation, other objects are skipped)
+	scan:
+		for scanner.Scan() {
+			switch e := scanner.Object().(type) {
+			case *osm.Node:
+				if int64(e.ID) > maxID {
+					maxID = int64(e.ID)
+				}
+			case *osm.Way, *osm.Relation:
+				break scan
+			}
+		}
+		err = scanner.Err()
+		scanner.Close()
+		fileInput.Close()
+		if err != nil {
+			return 0, fmt.Errorf("scanner returned error: %v", err)
+		}
+	}
+	return maxID, nil
+}
@@ -0,0 +1,98 @@
+/*
+Purpose:
+- Tests of ID selection for new nodes
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/paulmach/osm"
+)
+
+// XML input with bounds element and high node IDs (node after way is not read)
+const highIDsInputXML = `<?xml version='1.0' encoding='UTF-8'?>
+<osm version="0.6" generator="test">
+  <bounds minlat="52.0" minlon="7.0" maxlat="52.5" maxlon="7.5"/>
+  <node id="5000000010" lat="52.1" lon="7.1" version="1"/>
+  <node id="5000000012" lat="52.2" lon="7.2" version="1"/>
+  <node id="4000000000" lat="52.3" lon="7.3" version="1"/>
+  <way id="30" version="1">
+    <nd ref="5000000010"/>
+    <nd ref="5000000012"/>
+  </way>
+  <node id="9000000000" lat="52.3" lon="7.3" version="1"/>
+</osm>
+`
+
+/*
+TestParseStartNodeAuto derives start ID from maximum node ID of XML input with bounds
+*/
+func TestParseStartNodeAuto(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osmpp-test-")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	inputFile := filepath.Join(dir, "in.osm")
+	err = ioutil.WriteFile(inputFile, []byte(highIDsInputXML), 0666)
+	if err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	maxID, err := maxInputNodeID([]string{inputFile})
+	if err != nil {
+		t.Fatalf("maxInputNodeID: %v", err)
+	}
+	if maxID != 5000000012 {
+		t.Errorf("maxInputNodeID = %d, expected 5000000012", maxID)
+	}
+
+	startNodeID, step, err := parseStartNode(startNodeAuto, []string{inputFile})
+	if err != nil {
+		t.Fatalf("parseStartNode: %v", err)
+	}
+	if startNodeID != 5001000000 || step != 1 {
+		t.Errorf("parseStartNode = %d, %d, expected 5001000000, 1", startNodeID, step)
+	}
+}
+
+/*
+TestParseStartNode checks number and negative values of startNode option
+*/
+func TestParseStartNode(t *testing.T) {
+	tests := []struct {
+		value     string
+		startNode osm.NodeID
+		step      osm.NodeID
+		valid     bool
+	}{
+		{"1000000000000", 1000000000000, 1, true},
+		{startNodeNegative, -1, -1, true},
+		{"0", 0, 0, false},
+		{"-5", 0, 0, false},
+		{"abc", 0, 0, false},
+	}
+
+	for _, test := range tests {
+		startNode, step, err := parseStartNode(test.value, nil)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: error %v, expected valid = %v", test.value, err, test.valid)
+			continue
+		}
+		if startNode != test.startNode || step != test.step {
+			t.Errorf("%s: %d, %d, expected %d, %d", test.value, startNode, step, test.startNode, test.step)
+		}
+	}
+}
@@ -0,0 +1,709 @@
+/*
+Purpose:
+- Output of new and modified node objects
+
+Description:
+- xml : OSM XML file with new nodes (e.g. node_network objects) and modified nodes (e.g. enriched
+        turning_circle/loop objects, with unmodified ID)
+- osc : osmChange file with new nodes in <create> block and modified nodes (with bumped version)
+        in <modify> block (e.g. for osmium apply-changes or osmosis --apply-change)
+- pbf : OSM PBF file with all input objects, new nodes added and modified nodes replacing the
+        originals (sorted by type and ID, requires a second pass over the input file)
+- geojson    : GeoJSON feature collection with new and modified nodes (tags as properties)
+- geojsonseq : newline-delimited GeoJSON (RFC 8142) with new and modified nodes (tags as properties)
+- The output format is selected by option or derived from the file extension.
+- Filename "-" writes to stdout (format xml if not given by option).
+- Several input files are written to one combined output or to one output per input file
+  (placeholder {input} in the output filename is replaced by the input base name).
+- Several output files (each with its own format) can be written at once.
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Klaus-Tockloth/osmpp/process"
+	"github.com/paulmach/osm"
+)
+
+// output formats
+const (
+	outputFormatXML = "xml"
+	outputFormatOSC = "osc"
+	outputFormatPBF = "pbf"
+
+	outputFormatGeoJSON    = "geojson"
+	outputFormatGeoJSONSeq = "geojsonseq"
+)
+
+// placeholder for input base name in output filename (one output per input file)
+const inputPlaceholder = "{input}"
+
+// outputFile defines an output file and its format
+type outputFile struct {
+	Filename string
+	Format   string
+}
+
+// nodeWriter defines the output of new and modified nodes (output file)
+type nodeWriter interface {
+	process.NodeWriter
+	Close() error   // finalizes output
+	Discard() error // drops output without finalizing it (removes file, data already written to stdout remains)
+}
+
+/*
+outputFormat returns output format (given format or derived from file extension)
+*/
+func outputFormat(format, filename string) (string, error) {
+	switch strings.ToLower(format) {
+	case outputFormatXML, outputFormatOSC, outputFormatPBF, outputFormatGeoJSON, outputFormatGeoJSONSeq:
+		return strings.ToLower(format), nil
+	case "":
+		switch strings.ToLower(filepath.Ext(filename)) {
+		case ".pbf":
+			return outputFormatPBF, nil
+		case ".osc":
+			return outputFormatOSC, nil
+		case ".geojson":
+			return outputFormatGeoJSON, nil
+		case ".geojsonl", ".geojsons", ".geojsonseq":
+			return outputFormatGeoJSONSeq, nil
+		}
+		return outputFormatXML, nil
+	}
+	return "", fmt.Errorf("unsupported output format '%s'", format)
+}
+
+/*
+parseOutputFiles parses comma-separated lists of output filenames and formats (empty format = derived from file extension)
+*/
+func parseOutputFiles(filenames, formats string) ([]outputFile, error) {
+	names := strings.Split(filenames, ",")
+	var formatNames []string
+	if formats != "" {
+		formatNames = strings.Split(formats, ",")
+		if len(formatNames) > len(names) {
+			return nil, fmt.Errorf("more output formats (%d) than output files (%d)", len(formatNames), len(names))
+		}
+	}
+
+	var outputFiles []outputFile
+	stdout := 0
+	for i, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, fmt.Errorf("empty output filename in '%s'", filenames)
+		}
+		formatName := ""
+		if i < len(formatNames) {
+			formatName = strings.TrimSpace(formatNames[i])
+		}
+		format, err := outputFormat(formatName, name)
+		if err != nil {
+			return nil, err
+		}
+		if name == stdioFilename {
+			stdout++
+		}
+		outputFiles = append(outputFiles, outputFile{Filename: name, Format: format})
+	}
+	if stdout > 1 {
+		return nil, fmt.Errorf("more than one output file written to stdout")
+	}
+	return outputFiles, nil
+}
+
+/*
+checkOutputFiles checks if output files fit to the input files
+*/
+func checkOutputFiles(outputFiles []outputFile, inputFiles int, perInput bool) error {
+	for _, output := range outputFiles {
+		if perInput {
+			if !strings.Contains(output.Filename, inputPlaceholder) {
+				return fmt.Errorf("%s: placeholder %s missing (required for one output per input file)", output.Filename, inputPlaceholder)
+			}
+			continue
+		}
+		if output.Format == outputFormatPBF && inputFiles > 1 {
+			return fmt.Errorf("%s: PBF output of several input files requires one output per input file", output.Filename)
+		}
+	}
+	return nil
+}
+
+/*
+perInputOutputFiles returns output files for input file (placeholder replaced by input base name)
+*/
+func perInputOutputFiles(outputFiles []outputFile, inputFile string) []outputFile {
+	var files []outputFile
+	for _, output := range outputFiles {
+		files = append(files, outputFile{
+			Filename: strings.Replace(output.Filename, inputPlaceholder, inputBaseName(inputFile), -1),
+			Format:   output.Format,
+		})
+	}
+	return files
+}
+
+/*
+createOutput creates output file (or uses stdout)
+*/
+func createOutput(filename string) (io.WriteCloser, error) {
+	if filename == stdioFilename {
+		return stdoutWriter{}, nil
+	}
+	return os.OpenFile(filename, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0666)
+}
+
+// stdoutWriter writes to stdout (stdout is not closed)
+type stdoutWriter struct{}
+
+/*
+Write writes data to stdout
+*/
+func (stdoutWriter) Write(p []byte) (int, error) {
+	return os.Stdout.Write(p)
+}
+
+/*
+Close does nothing
+*/
+func (stdoutWriter) Close() error {
+	return nil
+}
+
+/*
+discardOutput closes and removes output file (stdout: nothing to do)
+*/
+func discardOutput(file io.WriteCloser, filename string) error {
+	if filename == stdioFilename {
+		return nil
+	}
+	err := file.Close()
+	if removeErr := os.Remove(filename); err == nil {
+		err = removeErr
+	}
+	if err != nil {
+		return fmt.Errorf("could not remove file: %v", err)
+	}
+	return nil
+}
+
+/*
+newNodeWriters creates node writer for all output files
+*/
+func newNodeWriters(outputFiles []outputFile, inputFilename string) (nodeWriter, error) {
+	var writers multiNodeWriter
+	for _, output := range outputFiles {
+		if output.Format == outputFormatPBF && inputFilename == stdioFilename {
+			return nil, fmt.Errorf("%s: PBF output requires input file (input is read twice, not possible with stdin)", output.Filename)
+		}
+		writer, err := newNodeWriter(output.Format, output.Filename, inputFilename)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", output.Filename, err)
+		}
+		writers = append(writers, writer)
+	}
+	if len(writers) == 1 {
+		return writers[0], nil
+	}
+	return writers, nil
+}
+
+/*
+newNodeWriter creates node writer for output format
+*/
+func newNodeWriter(format, filename, inputFilename string) (nodeWriter, error) {
+	switch format {
+	case outputFormatPBF:
+		return newPBFNodeWriter(filename, inputFilename), nil
+	case outputFormatOSC:
+		return newOSCNodeWriter(filename)
+	case outputFormatGeoJSON:
+		return newGeoJSONNodeWriter(filename), nil
+	case outputFormatGeoJSONSeq:
+		return newGeoJSONSeqNodeWriter(filename)
+	default:
+		return newXMLNodeWriter(filename, "osm")
+	}
+}
+
+// multiNodeWriter writes nodes to several node writers
+type multiNodeWriter []nodeWriter
+
+/*
+WriteNewNode writes new node to all node writers
+*/
+func (m multiNodeWriter) WriteNewNode(node *osm.Node) error {
+	for _, w := range m {
+		err := w.WriteNewNode(node)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+WriteModifiedNode writes modified node to all node writers
+*/
+func (m multiNodeWriter) WriteModifiedNode(node *osm.Node) error {
+	for _, w := range m {
+		err := w.WriteModifiedNode(node)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+Close closes all node writers
+*/
+func (m multiNodeWriter) Close() error {
+	for _, w := range m {
+		err := w.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+Discard discards all node writers
+*/
+func (m multiNodeWriter) Discard() error {
+	var firstErr error
+	for _, w := range m {
+		err := w.Discard()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// xmlNodeWriter writes nodes to OSM XML file
+type xmlNodeWriter struct {
+	filename string
+	file     io.WriteCloser
+	writer   *bufio.Writer
+	root     string // root element (e.g. "osm")
+}
+
+/*
+newXMLNodeWriter creates OSM XML file and writes header
+*/
+func newXMLNodeWriter(filename, root string) (*xmlNodeWriter, error) {
+	file, err := createOutput(filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not open file: %v", err)
+	}
+	writer := bufio.NewWriter(file)
+	_, err = fmt.Fprintf(writer, "<?xml version='1.0' encoding='UTF-8'?>\n")
+	if err != nil {
+		return nil, fmt.Errorf("error writing file: %v", err)
+	}
+	_, err = fmt.Fprintf(writer, "<%s version='0.6' generator='%s'>\n", root, progName)
+	if err != nil {
+		return nil, fmt.Errorf("error writing file: %v", err)
+	}
+
+	return &xmlNodeWriter{filename: filename, file: file, writer: writer, root: root}, nil
+}
+
+/*
+WriteNewNode writes new node
+*/
+func (w *xmlNodeWriter) WriteNewNode(node *osm.Node) error {
+	return w.writeNode(node)
+}
+
+/*
+WriteModifiedNode writes modified node
+*/
+func (w *xmlNodeWriter) WriteModifiedNode(node *osm.Node) error {
+	return w.writeNode(node)
+}
+
+/*
+writeNode writes node as XML element
+*/
+func (w *xmlNodeWriter) writeNode(node *osm.Node) error {
+	data, err := xml.MarshalIndent(node, "  ", "  ")
+	if err != nil {
+		return fmt.Errorf("error <%v> at xml.MarshalIndent()", err)
+	}
+	_, err = fmt.Fprintf(w.writer, "%s\n", string(data))
+	if err != nil {
+		return fmt.Errorf("error writing output file: %v", err)
+	}
+	return nil
+}
+
+/*
+Close writes footer and closes file
+*/
+func (w *xmlNodeWriter) Close() error {
+	_, err := fmt.Fprintf(w.writer, "</%s>\n", w.root)
+	if err != nil {
+		return fmt.Errorf("error writing file: %v", err)
+	}
+	err = w.writer.Flush()
+	if err != nil {
+		return fmt.Errorf("could not flush file buffer: %v", err)
+	}
+	err = w.file.Close()
+	if err != nil {
+		return fmt.Errorf("could not close file: %v", err)
+	}
+	return nil
+}
+
+/*
+Discard removes file (footer is not written)
+*/
+func (w *xmlNodeWriter) Discard() error {
+	return discardOutput(w.file, w.filename)
+}
+
+// oscNodeWriter writes nodes to osmChange file
+type oscNodeWriter struct {
+	*xmlNodeWriter
+	block string // open action block ("create" or "modify")
+}
+
+/*
+newOSCNodeWriter creates osmChange file and writes header
+*/
+func newOSCNodeWriter(filename string) (*oscNodeWriter, error) {
+	xmlWriter, err := newXMLNodeWriter(filename, "osmChange")
+	if err != nil {
+		return nil, err
+	}
+	return &oscNodeWriter{xmlNodeWriter: xmlWriter}, nil
+}
+
+/*
+WriteNewNode writes new node into <create> block
+*/
+func (w *oscNodeWriter) WriteNewNode(node *osm.Node) error {
+	err := w.openBlock("create")
+	if err != nil {
+		return err
+	}
+	return w.writeNode(node)
+}
+
+/*
+WriteModifiedNode writes modified node (with bumped version) into <modify> block
+*/
+func (w *oscNodeWriter) WriteModifiedNode(node *osm.Node) error {
+	err := w.openBlock("modify")
+	if err != nil {
+		return err
+	}
+	modifiedNode := *node
+	modifiedNode.Version++
+	return w.writeNode(&modifiedNode)
+}
+
+/*
+openBlock closes current action block and opens new one (if required)
+*/
+func (w *oscNodeWriter) openBlock(block string) error {
+	if w.block == block {
+		return nil
+	}
+	err := w.closeBlock()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w.writer, "<%s>\n", block)
+	if err != nil {
+		return fmt.Errorf("error writing file: %v", err)
+	}
+	w.block = block
+	return nil
+}
+
+/*
+closeBlock closes current action block
+*/
+func (w *oscNodeWriter) closeBlock() error {
+	if w.block == "" {
+		return nil
+	}
+	_, err := fmt.Fprintf(w.writer, "</%s>\n", w.block)
+	if err != nil {
+		return fmt.Errorf("error writing file: %v", err)
+	}
+	w.block = ""
+	return nil
+}
+
+/*
+Close closes current action block, writes footer and closes file
+*/
+func (w *oscNodeWriter) Close() error {
+	err := w.closeBlock()
+	if err != nil {
+		return err
+	}
+	return w.xmlNodeWriter.Close()
+}
+
+// geoJSONNodeWriter writes nodes as GeoJSON feature collection (written on close)
+type geoJSONNodeWriter struct {
+	filename string
+	features []geoJSONFeature
+}
+
+/*
+newGeoJSONNodeWriter creates GeoJSON node writer
+*/
+func newGeoJSONNodeWriter(filename string) *geoJSONNodeWriter {
+	return &geoJSONNodeWriter{filename: filename}
+}
+
+/*
+WriteNewNode collects new node as point feature
+*/
+func (w *geoJSONNodeWriter) WriteNewNode(node *osm.Node) error {
+	w.features = append(w.features, newNodeFeature(node, "create"))
+	return nil
+}
+
+/*
+WriteModifiedNode collects modified node as point feature
+*/
+func (w *geoJSONNodeWriter) WriteModifiedNode(node *osm.Node) error {
+	w.features = append(w.features, newNodeFeature(node, "modify"))
+	return nil
+}
+
+/*
+Close writes GeoJSON file
+*/
+func (w *geoJSONNodeWriter) Close() error {
+	return writeGeoJSONFile(w.filename, w.features)
+}
+
+/*
+Discard drops collected features (nothing written yet)
+*/
+func (w *geoJSONNodeWriter) Discard() error {
+	w.features = nil
+	return nil
+}
+
+// geoJSONSeqNodeWriter writes nodes as newline-delimited GeoJSON features
+type geoJSONSeqNodeWriter struct {
+	filename string
+	file     io.WriteCloser
+	writer   *bufio.Writer
+	encoder  *json.Encoder
+}
+
+/*
+newGeoJSONSeqNodeWriter creates GeoJSONSeq file
+*/
+func newGeoJSONSeqNodeWriter(filename string) (*geoJSONSeqNodeWriter, error) {
+	file, err := createOutput(filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not open file: %v", err)
+	}
+	writer := bufio.NewWriter(file)
+	return &geoJSONSeqNodeWriter{filename: filename, file: file, writer: writer, encoder: json.NewEncoder(writer)}, nil
+}
+
+/*
+WriteNewNode writes new node as point feature
+*/
+func (w *geoJSONSeqNodeWriter) WriteNewNode(node *osm.Node) error {
+	return w.writeFeature(newNodeFeature(node, "create"))
+}
+
+/*
+WriteModifiedNode writes modified node as point feature
+*/
+func (w *geoJSONSeqNodeWriter) WriteModifiedNode(node *osm.Node) error {
+	return w.writeFeature(newNodeFeature(node, "modify"))
+}
+
+/*
+writeFeature writes feature as record (record separator, JSON text, line feed)
+*/
+func (w *geoJSONSeqNodeWriter) writeFeature(feature geoJSONFeature) error {
+	err := w.writer.WriteByte(0x1e)
+	if err != nil {
+		return fmt.Errorf("error writing file: %v", err)
+	}
+	err = w.encoder.Encode(feature)
+	if err != nil {
+		return fmt.Errorf("error writing file: %v", err)
+	}
+	return nil
+}
+
+/*
+Close flushes and closes file
+*/
+func (w *geoJSONSeqNodeWriter) Close() error {
+	err := w.writer.Flush()
+	if err != nil {
+		return fmt.Errorf("could not flush file buffer: %v", err)
+	}
+	err = w.file.Close()
+	if err != nil {
+		return fmt.Errorf("could not close file: %v", err)
+	}
+	return nil
+}
+
+/*
+Discard removes file
+*/
+func (w *geoJSONSeqNodeWriter) Discard() error {
+	return discardOutput(w.file, w.filename)
+}
+
+// pbfNodeWriter merges new and modified nodes into the input data and writes all objects to PBF file
+type pbfNodeWriter struct {
+	filename      string
+	inputFilename string
+	newNodes      []*osm.Node
+	modifiedNodes map[osm.NodeID]*osm.Node
+}
+
+/*
+newPBFNodeWriter creates PBF node writer (output is written on close)
+*/
+func newPBFNodeWriter(filename, inputFilename string) *pbfNodeWriter {
+	return &pbfNodeWriter{
+		filename:      filename,
+		inputFilename: inputFilename,
+		modifiedNodes: make(map[osm.NodeID]*osm.Node),
+	}
+}
+
+/*
+WriteNewNode collects new node
+*/
+func (w *pbfNodeWriter) WriteNewNode(node *osm.Node) error {
+	w.newNodes = append(w.newNodes, node)
+	return nil
+}
+
+/*
+WriteModifiedNode collects modified node
+*/
+func (w *pbfNodeWriter) WriteModifiedNode(node *osm.Node) error {
+	w.modifiedNodes[node.ID] = node
+	return nil
+}
+
+/*
+Close reads input file again and writes all objects (including new and modified nodes) to PBF file
+*/
+func (w *pbfNodeWriter) Close() error {
+	sort.Slice(w.newNodes, func(i, j int) bool { return w.newNodes[i].ID < w.newNodes[j].ID })
+
+	fileInput, err := openInput(w.inputFilename)
+	if err != nil {
+		return fmt.Errorf("could not open file: %v", err)
+	}
+	defer fileInput.Close()
+	scanner, _, err := newOSMScanner(context.Background(), fileInput, w.inputFilename)
+	if err != nil {
+		return fmt.Errorf("could not create scanner: %v", err)
+	}
+	defer scanner.Close()
+
+	fileOutput, err := createOutput(w.filename)
+	if err != nil {
+		return fmt.Errorf("could not open file: %v", err)
+	}
+	writer := bufio.NewWriterSize(fileOutput, 1024*1024)
+	encoder := newPBFEncoder(writer, progName)
+
+	// new nodes are merged into the input nodes (sorted by ID)
+	next := 0
+	writeNewNodesBefore := func(id osm.NodeID) error {
+		for ; next < len(w.newNodes) && w.newNodes[next].ID < id; next++ {
+			err := encoder.WriteObject(w.newNodes[next])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var maxNodeID osm.NodeID = 1<<63 - 1
+	for scanner.Scan() {
+		object := scanner.Object()
+		switch e := object.(type) {
+		case *osm.Node:
+			err = writeNewNodesBefore(e.ID)
+			if modifiedNode, found := w.modifiedNodes[e.ID]; found {
+				object = modifiedNode
+			}
+		case *osm.Way, *osm.Relation:
+			err = writeNewNodesBefore(maxNodeID)
+		default:
+			continue // other objects (e.g. bounds of XML input) are not part of PBF data
+		}
+		if err != nil {
+			return err
+		}
+		err = encoder.WriteObject(object)
+		if err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("scanner returned error: %v", err)
+	}
+
+	err = writeNewNodesBefore(maxNodeID)
+	if err != nil {
+		return err
+	}
+	err = encoder.Close()
+	if err != nil {
+		return err
+	}
+	err = writer.Flush()
+	if err != nil {
+		return fmt.Errorf("could not flush file buffer: %v", err)
+	}
+	return fileOutput.Close()
+}
+
+/*
+Discard drops collected nodes (nothing written yet)
+*/
+func (w *pbfNodeWriter) Discard() error {
+	w.newNodes = nil
+	w.modifiedNodes = nil
+	return nil
+}
@@ -0,0 +1,115 @@
+/*
+Purpose:
+- Tests of output of new and modified node objects
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmpbf"
+)
+
+// XML input with bounds element before the nodes
+const boundsInputXML = `<?xml version='1.0' encoding='UTF-8'?>
+<osm version="0.6" generator="test">
+  <bounds minlat="52.0" minlon="7.0" maxlat="52.5" maxlon="7.5"/>
+  <node id="10" lat="52.1" lon="7.1" version="1" timestamp="2019-09-13T06:50:45Z"/>
+  <node id="11" lat="52.2" lon="7.2" version="1" timestamp="2019-09-13T06:50:45Z">
+    <tag k="highway" v="turning_circle"/>
+  </node>
+  <node id="20" lat="52.3" lon="7.3" version="1" timestamp="2019-09-13T06:50:45Z"/>
+  <way id="30" version="1" timestamp="2019-09-13T06:50:45Z">
+    <nd ref="10"/>
+    <nd ref="11"/>
+    <tag k="highway" v="residential"/>
+  </way>
+  <relation id="40" version="1" timestamp="2019-09-13T06:50:45Z">
+    <member type="way" ref="30" role=""/>
+    <tag k="type" v="route"/>
+  </relation>
+</osm>
+`
+
+/*
+TestPBFNodeWriterXMLInput merges new and modified nodes into XML input with bounds (sorted by type and ID)
+*/
+func TestPBFNodeWriterXMLInput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osmpp-test-")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	inputFile := filepath.Join(dir, "in.osm")
+	outputFile := filepath.Join(dir, "out.pbf")
+	err = ioutil.WriteFile(inputFile, []byte(boundsInputXML), 0666)
+	if err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	writer := newPBFNodeWriter(outputFile, inputFile)
+	for _, id := range []osm.NodeID{1000000000001, 15, 1000000000000, 5} {
+		err = writer.WriteNewNode(&osm.Node{ID: id, Lat: 52.4, Lon: 7.4, Visible: true})
+		if err != nil {
+			t.Fatalf("WriteNewNode: %v", err)
+		}
+	}
+	modifiedNode := &osm.Node{ID: 11, Lat: 52.2, Lon: 7.2, Version: 1, Visible: true,
+		Tags: osm.Tags{{Key: "highway", Value: "turning_circle"}, {Key: "fzk_turning", Value: "residential"}}}
+	err = writer.WriteModifiedNode(modifiedNode)
+	if err != nil {
+		t.Fatalf("WriteModifiedNode: %v", err)
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	file, err := os.Open(outputFile)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer file.Close()
+	scanner := osmpbf.New(context.Background(), file, 1)
+	defer scanner.Close()
+	objectIDs := []osm.ObjectID{}
+	for scanner.Scan() {
+		object := scanner.Object()
+		objectIDs = append(objectIDs, object.ObjectID())
+		if node, ok := object.(*osm.Node); ok && node.ID == 11 && node.Tags.Find("fzk_turning") != "residential" {
+			t.Errorf("node 11: tags %v, expected modified node", node.Tags)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("scanner error: %v", err)
+	}
+
+	expected := []osm.ObjectID{
+		osm.NodeID(5).ObjectID(0),
+		osm.NodeID(10).ObjectID(1),
+		osm.NodeID(11).ObjectID(1),
+		osm.NodeID(15).ObjectID(0),
+		osm.NodeID(20).ObjectID(1),
+		osm.NodeID(1000000000000).ObjectID(0),
+		osm.NodeID(1000000000001).ObjectID(0),
+		osm.WayID(30).ObjectID(1),
+		osm.RelationID(40).ObjectID(1),
+	}
+	if !reflect.DeepEqual(objectIDs, expected) {
+		t.Errorf("objects = %v, expected %v", objectIDs, expected)
+	}
+}
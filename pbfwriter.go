@@ -0,0 +1,448 @@
+/*
+Purpose:
+- OSM PBF encoder
+
+Description:
+- Writes OSM objects in PBF format (nodes as DenseNodes, zlib compressed blobs).
+- Objects must be written in PBF order (nodes, ways, relations; each sorted by ID).
+- The protobuf messages are encoded by hand (only the fields used by osmpp).
+
+Links:
+- https://wiki.openstreetmap.org/wiki/PBF_Format
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/paulmach/osm"
+)
+
+// maximum number of objects per primitive block
+const pbfBlockSize = 8000
+
+// protobuf wire types
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+// pbfEncoder writes OSM objects in PBF format
+type pbfEncoder struct {
+	w             io.Writer
+	program       string
+	headerWritten bool
+	objects       []osm.Object // objects of current block (all of the same type)
+	objectType    osm.Type     // type of objects in current block
+}
+
+/*
+newPBFEncoder creates new PBF encoder
+*/
+func newPBFEncoder(w io.Writer, program string) *pbfEncoder {
+	return &pbfEncoder{w: w, program: program}
+}
+
+/*
+WriteObject adds object to current block (block is written if full or object type changes)
+*/
+func (e *pbfEncoder) WriteObject(o osm.Object) error {
+	var objectType osm.Type
+	switch o.(type) {
+	case *osm.Node:
+		objectType = osm.TypeNode
+	case *osm.Way:
+		objectType = osm.TypeWay
+	case *osm.Relation:
+		objectType = osm.TypeRelation
+	default:
+		return nil // other objects (e.g. changesets) are not part of PBF data
+	}
+
+	if len(e.objects) > 0 && (objectType != e.objectType || len(e.objects) >= pbfBlockSize) {
+		err := e.flush()
+		if err != nil {
+			return err
+		}
+	}
+	e.objectType = objectType
+	e.objects = append(e.objects, o)
+
+	return nil
+}
+
+/*
+Close writes remaining objects
+*/
+func (e *pbfEncoder) Close() error {
+	if !e.headerWritten {
+		err := e.writeHeader()
+		if err != nil {
+			return err
+		}
+	}
+	return e.flush()
+}
+
+/*
+writeHeader writes OSMHeader block
+*/
+func (e *pbfEncoder) writeHeader() error {
+	header := &pbBuffer{}
+	header.string(4, "OsmSchema-V0.6")
+	header.string(4, "DenseNodes")
+	header.string(5, "Sort.Type_then_ID")
+	header.string(16, e.program)
+
+	e.headerWritten = true
+	return e.writeBlob("OSMHeader", header.b)
+}
+
+/*
+flush writes current block as OSMData blob
+*/
+func (e *pbfEncoder) flush() error {
+	if !e.headerWritten {
+		err := e.writeHeader()
+		if err != nil {
+			return err
+		}
+	}
+	if len(e.objects) == 0 {
+		return nil
+	}
+
+	st := newStringTable()
+	group := &pbBuffer{}
+	switch e.objectType {
+	case osm.TypeNode:
+		group.message(2, encodeDenseNodes(e.objects, st))
+	case osm.TypeWay:
+		for _, o := range e.objects {
+			group.message(3, encodeWay(o.(*osm.Way), st))
+		}
+	case osm.TypeRelation:
+		for _, o := range e.objects {
+			group.message(4, encodeRelation(o.(*osm.Relation), st))
+		}
+	}
+
+	block := &pbBuffer{}
+	block.message(1, st.encode())
+	block.message(2, group.b)
+	e.objects = e.objects[:0]
+
+	return e.writeBlob("OSMData", block.b)
+}
+
+/*
+writeBlob writes blob header and zlib compressed blob
+*/
+func (e *pbfEncoder) writeBlob(blobType string, data []byte) error {
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	_, err := zw.Write(data)
+	if err != nil {
+		return fmt.Errorf("error compressing blob: %v", err)
+	}
+	err = zw.Close()
+	if err != nil {
+		return fmt.Errorf("error compressing blob: %v", err)
+	}
+
+	blob := &pbBuffer{}
+	blob.uint(2, uint64(len(data)))
+	blob.bytes(3, compressed.Bytes())
+
+	blobHeader := &pbBuffer{}
+	blobHeader.string(1, blobType)
+	blobHeader.uint(3, uint64(len(blob.b)))
+
+	size := make([]byte, 4)
+	binary.BigEndian.PutUint32(size, uint32(len(blobHeader.b)))
+	for _, part := range [][]byte{size, blobHeader.b, blob.b} {
+		_, err = e.w.Write(part)
+		if err != nil {
+			return fmt.Errorf("error writing PBF data: %v", err)
+		}
+	}
+
+	return nil
+}
+
+/*
+encodeDenseNodes encodes nodes as DenseNodes message
+*/
+func encodeDenseNodes(objects []osm.Object, st *stringTable) []byte {
+	var ids, lats, lons, timestamps, changesets, uids, userSids []int64
+	var versions, keysVals []uint64
+	var lastID, lastLat, lastLon, lastTimestamp, lastChangeset, lastUID, lastUserSid int64
+
+	for _, o := range objects {
+		node := o.(*osm.Node)
+		id := int64(node.ID)
+		lat := int64(math.Round(node.Lat * 1e7))
+		lon := int64(math.Round(node.Lon * 1e7))
+		timestamp := pbfTimestamp(node.Timestamp)
+		changeset := int64(node.ChangesetID)
+		uid := int64(node.UserID)
+		userSid := int64(st.index(node.User))
+
+		ids = append(ids, id-lastID)
+		lats = append(lats, lat-lastLat)
+		lons = append(lons, lon-lastLon)
+		versions = append(versions, uint64(node.Version))
+		timestamps = append(timestamps, timestamp-lastTimestamp)
+		changesets = append(changesets, changeset-lastChangeset)
+		uids = append(uids, uid-lastUID)
+		userSids = append(userSids, userSid-lastUserSid)
+		lastID, lastLat, lastLon, lastTimestamp, lastChangeset, lastUID, lastUserSid = id, lat, lon, timestamp, changeset, uid, userSid
+
+		for _, tag := range node.Tags {
+			keysVals = append(keysVals, uint64(st.index(tag.Key)), uint64(st.index(tag.Value)))
+		}
+		keysVals = append(keysVals, 0)
+	}
+
+	denseInfo := &pbBuffer{}
+	denseInfo.packedUint(1, versions)
+	denseInfo.packedSint(2, timestamps)
+	denseInfo.packedSint(3, changesets)
+	denseInfo.packedSint(4, uids)
+	denseInfo.packedSint(5, userSids)
+
+	dense := &pbBuffer{}
+	dense.packedSint(1, ids)
+	dense.message(5, denseInfo.b)
+	dense.packedSint(8, lats)
+	dense.packedSint(9, lons)
+	dense.packedUint(10, keysVals)
+
+	return dense.b
+}
+
+/*
+encodeWay encodes way as Way message
+*/
+func encodeWay(way *osm.Way, st *stringTable) []byte {
+	keys, vals := encodeTags(way.Tags, st)
+	refs := make([]int64, 0, len(way.Nodes))
+	var lastRef int64
+	for _, node := range way.Nodes {
+		refs = append(refs, int64(node.ID)-lastRef)
+		lastRef = int64(node.ID)
+	}
+
+	m := &pbBuffer{}
+	m.uint(1, uint64(way.ID))
+	m.packedUint(2, keys)
+	m.packedUint(3, vals)
+	m.message(4, encodeInfo(way.Version, way.Timestamp, int64(way.ChangesetID), int64(way.UserID), way.User, st))
+	m.packedSint(8, refs)
+
+	return m.b
+}
+
+/*
+encodeRelation encodes relation as Relation message
+*/
+func encodeRelation(relation *osm.Relation, st *stringTable) []byte {
+	keys, vals := encodeTags(relation.Tags, st)
+	roles := make([]uint64, 0, len(relation.Members))
+	memids := make([]int64, 0, len(relation.Members))
+	types := make([]uint64, 0, len(relation.Members))
+	var lastRef int64
+	for _, member := range relation.Members {
+		roles = append(roles, uint64(st.index(member.Role)))
+		memids = append(memids, member.Ref-lastRef)
+		lastRef = member.Ref
+		switch member.Type {
+		case osm.TypeNode:
+			types = append(types, 0)
+		case osm.TypeWay:
+			types = append(types, 1)
+		default:
+			types = append(types, 2)
+		}
+	}
+
+	m := &pbBuffer{}
+	m.uint(1, uint64(relation.ID))
+	m.packedUint(2, keys)
+	m.packedUint(3, vals)
+	m.message(4, encodeInfo(relation.Version, relation.Timestamp, int64(relation.ChangesetID), int64(relation.UserID), relation.User, st))
+	m.packedUint(8, roles)
+	m.packedSint(9, memids)
+	m.packedUint(10, types)
+
+	return m.b
+}
+
+/*
+encodeTags encodes tags as key and value string table indexes
+*/
+func encodeTags(tags osm.Tags, st *stringTable) ([]uint64, []uint64) {
+	keys := make([]uint64, 0, len(tags))
+	vals := make([]uint64, 0, len(tags))
+	for _, tag := range tags {
+		keys = append(keys, uint64(st.index(tag.Key)))
+		vals = append(vals, uint64(st.index(tag.Value)))
+	}
+	return keys, vals
+}
+
+/*
+encodeInfo encodes Info message
+*/
+func encodeInfo(version int, timestamp time.Time, changeset, uid int64, user string, st *stringTable) []byte {
+	m := &pbBuffer{}
+	m.uint(1, uint64(version))
+	m.uint(2, uint64(pbfTimestamp(timestamp)))
+	m.uint(3, uint64(changeset))
+	m.uint(4, uint64(uid))
+	m.uint(5, uint64(st.index(user)))
+	return m.b
+}
+
+/*
+pbfTimestamp returns timestamp in seconds (date granularity 1000 ms)
+*/
+func pbfTimestamp(timestamp time.Time) int64 {
+	if timestamp.IsZero() || timestamp.Unix() < 0 {
+		return 0
+	}
+	return timestamp.Unix()
+}
+
+// stringTable defines the string table of a primitive block
+type stringTable struct {
+	indexes map[string]int
+	strings []string
+}
+
+/*
+newStringTable creates new string table (index 0 is reserved for the empty string)
+*/
+func newStringTable() *stringTable {
+	return &stringTable{indexes: map[string]int{"": 0}, strings: []string{""}}
+}
+
+/*
+index returns index of string (string is added if not found)
+*/
+func (t *stringTable) index(s string) int {
+	if i, found := t.indexes[s]; found {
+		return i
+	}
+	i := len(t.strings)
+	t.indexes[s] = i
+	t.strings = append(t.strings, s)
+	return i
+}
+
+/*
+encode encodes StringTable message
+*/
+func (t *stringTable) encode() []byte {
+	m := &pbBuffer{}
+	for _, s := range t.strings {
+		m.bytes(1, []byte(s))
+	}
+	return m.b
+}
+
+// pbBuffer is a minimal protobuf message encoder
+type pbBuffer struct {
+	b []byte
+}
+
+/*
+varint appends unsigned varint
+*/
+func (p *pbBuffer) varint(v uint64) {
+	for v >= 0x80 {
+		p.b = append(p.b, byte(v)|0x80)
+		v >>= 7
+	}
+	p.b = append(p.b, byte(v))
+}
+
+/*
+key appends field key
+*/
+func (p *pbBuffer) key(field, wireType int) {
+	p.varint(uint64(field<<3 | wireType))
+}
+
+/*
+uint appends varint field
+*/
+func (p *pbBuffer) uint(field int, v uint64) {
+	p.key(field, wireVarint)
+	p.varint(v)
+}
+
+/*
+bytes appends length delimited field
+*/
+func (p *pbBuffer) bytes(field int, b []byte) {
+	p.key(field, wireBytes)
+	p.varint(uint64(len(b)))
+	p.b = append(p.b, b...)
+}
+
+/*
+string appends string field
+*/
+func (p *pbBuffer) string(field int, s string) {
+	p.bytes(field, []byte(s))
+}
+
+/*
+message appends embedded message field
+*/
+func (p *pbBuffer) message(field int, m []byte) {
+	p.bytes(field, m)
+}
+
+/*
+packedUint appends packed repeated varint field
+*/
+func (p *pbBuffer) packedUint(field int, vs []uint64) {
+	if len(vs) == 0 {
+		return
+	}
+	packed := &pbBuffer{}
+	for _, v := range vs {
+		packed.varint(v)
+	}
+	p.bytes(field, packed.b)
+}
+
+/*
+packedSint appends packed repeated zigzag encoded varint field
+*/
+func (p *pbBuffer) packedSint(field int, vs []int64) {
+	if len(vs) == 0 {
+		return
+	}
+	packed := &pbBuffer{}
+	for _, v := range vs {
+		packed.varint(uint64((v << 1) ^ (v >> 63)))
+	}
+	p.bytes(field, packed.b)
+}
@@ -0,0 +1,228 @@
+/*
+Purpose:
+- Tests of OSM PBF encoder (round trip with osmpbf decoder)
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmpbf"
+)
+
+/*
+TestPBFEncoderRoundTrip writes objects with pbfEncoder and reads them back with osmpbf
+*/
+func TestPBFEncoderRoundTrip(t *testing.T) {
+	timestamp := time.Date(2019, 9, 13, 6, 50, 45, 0, time.UTC)
+
+	// more nodes than fit into one block, negative coordinates and IDs, deltas in both directions
+	objects := []osm.Object{}
+	nodeCount := pbfBlockSize + 5
+	for i := 0; i < nodeCount; i++ {
+		node := &osm.Node{
+			ID:          osm.NodeID(2*i - 10),
+			Lat:         -45.1234567 + float64(i%100)*0.0012345,
+			Lon:         170.7654321 - float64(i%77)*0.0123456,
+			Version:     1 + i%5,
+			Timestamp:   timestamp.Add(time.Duration(i%13) * time.Hour),
+			ChangesetID: osm.ChangesetID(1000 + i%7),
+			UserID:      osm.UserID(i % 3),
+			User:        []string{"", "alice", "bob"}[i%3],
+		}
+		if i%100 == 0 {
+			node.Tags = osm.Tags{{Key: "highway", Value: "turning_circle"}, {Key: "ref", Value: "X32"}}
+		}
+		objects = append(objects, node)
+	}
+
+	objects = append(objects,
+		&osm.Way{ID: 10, Version: 2, Timestamp: timestamp, ChangesetID: 5, UserID: 1, User: "alice",
+			Nodes: osm.WayNodes{{ID: 5}, {ID: 3}, {ID: 1000000}, {ID: -4}}, Tags: osm.Tags{{Key: "highway", Value: "residential"}}},
+		&osm.Way{ID: 11, Version: 1, Timestamp: timestamp, ChangesetID: 5, UserID: 2, User: "bob",
+			Nodes: osm.WayNodes{{ID: 7}, {ID: 9}}},
+		&osm.Relation{ID: 20, Version: 3, Timestamp: timestamp, ChangesetID: 6, UserID: 1, User: "alice",
+			Members: osm.Members{
+				{Type: osm.TypeNode, Ref: 12, Role: "stop"},
+				{Type: osm.TypeWay, Ref: 10, Role: ""},
+				{Type: osm.TypeRelation, Ref: 21, Role: "sub"},
+				{Type: osm.TypeWay, Ref: 11, Role: "forward"},
+			},
+			Tags: osm.Tags{{Key: "type", Value: "route"}, {Key: "route", Value: "bicycle"}}},
+	)
+
+	var buf bytes.Buffer
+	encoder := newPBFEncoder(&buf, "osmpp-test")
+	for _, o := range objects {
+		err := encoder.WriteObject(o)
+		if err != nil {
+			t.Fatalf("WriteObject: %v", err)
+		}
+	}
+	err := encoder.Close()
+	if err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// header, 2 node blocks (split at pbfBlockSize), 1 way block, 1 relation block
+	expectedBlobs := []string{"OSMHeader", "OSMData", "OSMData", "OSMData", "OSMData"}
+	blobs := blobTypes(t, buf.Bytes())
+	if !reflect.DeepEqual(blobs, expectedBlobs) {
+		t.Errorf("blobs = %v, expected %v", blobs, expectedBlobs)
+	}
+
+	scanner := osmpbf.New(context.Background(), bytes.NewReader(buf.Bytes()), 1)
+	defer scanner.Close()
+	read := []osm.Object{}
+	for scanner.Scan() {
+		read = append(read, scanner.Object())
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("scanner error: %v", err)
+	}
+	if len(read) != len(objects) {
+		t.Fatalf("%d objects read, expected %d", len(read), len(objects))
+	}
+
+	for i, o := range objects {
+		switch expected := o.(type) {
+		case *osm.Node:
+			node, ok := read[i].(*osm.Node)
+			if !ok {
+				t.Fatalf("object %d: %T read, expected node", i, read[i])
+			}
+			if node.ID != expected.ID || math.Abs(node.Lat-expected.Lat) > 1e-7 || math.Abs(node.Lon-expected.Lon) > 1e-7 {
+				t.Fatalf("node %d: got %v %v,%v, expected %v %v,%v", i, node.ID, node.Lat, node.Lon, expected.ID, expected.Lat, expected.Lon)
+			}
+			if node.Version != expected.Version || !node.Timestamp.Equal(expected.Timestamp) || node.ChangesetID != expected.ChangesetID ||
+				node.UserID != expected.UserID || node.User != expected.User {
+				t.Fatalf("node %d: metadata differs: got %+v, expected %+v", i, node, expected)
+			}
+			if !equalTags(node.Tags, expected.Tags) {
+				t.Fatalf("node %d: tags %v, expected %v", i, node.Tags, expected.Tags)
+			}
+
+		case *osm.Way:
+			way, ok := read[i].(*osm.Way)
+			if !ok {
+				t.Fatalf("object %d: %T read, expected way", i, read[i])
+			}
+			if way.ID != expected.ID || way.Version != expected.Version || way.User != expected.User || !way.Timestamp.Equal(expected.Timestamp) {
+				t.Errorf("way %d: got %+v, expected %+v", expected.ID, way, expected)
+			}
+			if !reflect.DeepEqual(way.Nodes.NodeIDs(), expected.Nodes.NodeIDs()) {
+				t.Errorf("way %d: refs %v, expected %v", expected.ID, way.Nodes.NodeIDs(), expected.Nodes.NodeIDs())
+			}
+			if !equalTags(way.Tags, expected.Tags) {
+				t.Errorf("way %d: tags %v, expected %v", expected.ID, way.Tags, expected.Tags)
+			}
+
+		case *osm.Relation:
+			relation, ok := read[i].(*osm.Relation)
+			if !ok {
+				t.Fatalf("object %d: %T read, expected relation", i, read[i])
+			}
+			if relation.ID != expected.ID || relation.Version != expected.Version || relation.User != expected.User {
+				t.Errorf("relation %d: got %+v, expected %+v", expected.ID, relation, expected)
+			}
+			if len(relation.Members) != len(expected.Members) {
+				t.Fatalf("relation %d: %d members, expected %d", expected.ID, len(relation.Members), len(expected.Members))
+			}
+			for j, member := range relation.Members {
+				e := expected.Members[j]
+				if member.Type != e.Type || member.Ref != e.Ref || member.Role != e.Role {
+					t.Errorf("relation %d member %d: got %v %v %q, expected %v %v %q", expected.ID, j, member.Type, member.Ref, member.Role, e.Type, e.Ref, e.Role)
+				}
+			}
+			if !equalTags(relation.Tags, expected.Tags) {
+				t.Errorf("relation %d: tags %v, expected %v", expected.ID, relation.Tags, expected.Tags)
+			}
+		}
+	}
+}
+
+/*
+TestPBFEncoderEmpty checks that an empty file contains the header only
+*/
+func TestPBFEncoderEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	err := newPBFEncoder(&buf, "osmpp-test").Close()
+	if err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	blobs := blobTypes(t, buf.Bytes())
+	if !reflect.DeepEqual(blobs, []string{"OSMHeader"}) {
+		t.Errorf("blobs = %v, expected [OSMHeader]", blobs)
+	}
+}
+
+/*
+blobTypes returns types of all blobs of PBF data (BlobHeader field 1 = type, field 3 = datasize)
+*/
+func blobTypes(t *testing.T, data []byte) []string {
+	t.Helper()
+	types := []string{}
+	for len(data) > 0 {
+		if len(data) < 4 {
+			t.Fatalf("truncated blob header size")
+		}
+		size := int(binary.BigEndian.Uint32(data))
+		header := data[4 : 4+size]
+		data = data[4+size:]
+
+		blobType := ""
+		dataSize := 0
+		for len(header) > 0 {
+			key, n := binary.Uvarint(header)
+			header = header[n:]
+			switch key & 7 {
+			case 0:
+				v, n := binary.Uvarint(header)
+				header = header[n:]
+				if key>>3 == 3 {
+					dataSize = int(v)
+				}
+			case 2:
+				l, n := binary.Uvarint(header)
+				header = header[n:]
+				if key>>3 == 1 {
+					blobType = string(header[:l])
+				}
+				header = header[l:]
+			default:
+				t.Fatalf("unexpected wire type %d in blob header", key&7)
+			}
+		}
+		if dataSize > len(data) {
+			t.Fatalf("blob %s: datasize %d exceeds remaining data %d", blobType, dataSize, len(data))
+		}
+		types = append(types, blobType)
+		data = data[dataSize:]
+	}
+	return types
+}
+
+/*
+equalTags compares tags (nil and empty tags are equal)
+*/
+func equalTags(a, b osm.Tags) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
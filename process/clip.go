@@ -0,0 +1,341 @@
+/*
+Purpose:
+- Clipping of derived nodes (bounding box or polygon)
+
+Description:
+- New nodes (node_network) and modified nodes (point objects) outside the clip area are dropped.
+  New nodes are clipped by the location of their source node (before an ID is assigned), so all new
+  nodes of one junction are kept or dropped together.
+- Polygon files: Osmosis polygon format (.poly) or GeoJSON (Polygon, MultiPolygon, Feature or
+  FeatureCollection of these). Rings are evaluated with the even-odd rule (holes are rings inside rings).
+- Counts before and after clipping and the extent of the kept nodes are reported in the result.
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package process
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Area defines a clip area
+type Area interface {
+	Contains(lat, lon float64) bool
+	String() string // description (e.g. for statistics)
+}
+
+// BBox defines a bounding box (degrees)
+type BBox struct {
+	MinLon, MinLat, MaxLon, MaxLat float64
+}
+
+/*
+ParseBBox parses bounding box "minLon,minLat,maxLon,maxLat" (left,bottom,right,top)
+*/
+func ParseBBox(value string) (BBox, error) {
+	items := strings.Split(value, ",")
+	if len(items) != 4 {
+		return BBox{}, fmt.Errorf("4 values expected (minLon,minLat,maxLon,maxLat), got %d", len(items))
+	}
+	values := make([]float64, 4)
+	for i, item := range items {
+		v, err := strconv.ParseFloat(strings.TrimSpace(item), 64)
+		if err != nil {
+			return BBox{}, fmt.Errorf("invalid value '%s': %v", item, err)
+		}
+		values[i] = v
+	}
+
+	b := BBox{MinLon: values[0], MinLat: values[1], MaxLon: values[2], MaxLat: values[3]}
+	if b.MinLon < -180 || b.MaxLon > 180 || b.MinLat < -90 || b.MaxLat > 90 {
+		return BBox{}, fmt.Errorf("values out of range (lon -180 .. 180, lat -90 .. 90)")
+	}
+	if b.MinLon >= b.MaxLon || b.MinLat >= b.MaxLat {
+		return BBox{}, fmt.Errorf("min values must be less than max values")
+	}
+	return b, nil
+}
+
+/*
+Contains reports whether location is inside bounding box (border included)
+*/
+func (b BBox) Contains(lat, lon float64) bool {
+	return lat >= b.MinLat && lat <= b.MaxLat && lon >= b.MinLon && lon <= b.MaxLon
+}
+
+/*
+String returns description of bounding box
+*/
+func (b BBox) String() string {
+	return fmt.Sprintf("bbox %.7f,%.7f,%.7f,%.7f", b.MinLon, b.MinLat, b.MaxLon, b.MaxLat)
+}
+
+// Polygon defines a clip polygon (rings of lon/lat points, even-odd rule)
+type Polygon struct {
+	Name   string
+	Rings  [][][2]float64
+	bounds BBox
+}
+
+/*
+LoadPolygon reads polygon file (Osmosis .poly format, other extensions: GeoJSON)
+*/
+func LoadPolygon(filename string) (*Polygon, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not read polygon file: %v", err)
+	}
+
+	var polygon *Polygon
+	if strings.ToLower(filepath.Ext(filename)) == ".poly" {
+		polygon, err = parsePoly(bytes.NewReader(data))
+	} else {
+		polygon, err = parseGeoJSONPolygon(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not parse polygon file: %v", err)
+	}
+	if polygon.Name == "" {
+		polygon.Name = filepath.Base(filename)
+	}
+	return polygon, nil
+}
+
+/*
+newPolygon creates polygon (rings with less than 3 points are rejected)
+*/
+func newPolygon(name string, rings [][][2]float64) (*Polygon, error) {
+	if len(rings) == 0 {
+		return nil, fmt.Errorf("no polygon rings found")
+	}
+	p := &Polygon{Name: name, Rings: rings, bounds: BBox{MinLon: 180, MinLat: 90, MaxLon: -180, MaxLat: -90}}
+	for i, ring := range rings {
+		if len(ring) < 3 {
+			return nil, fmt.Errorf("ring %d has %d points (at least 3 required)", i+1, len(ring))
+		}
+		for _, point := range ring {
+			if point[0] < p.bounds.MinLon {
+				p.bounds.MinLon = point[0]
+			}
+			if point[0] > p.bounds.MaxLon {
+				p.bounds.MaxLon = point[0]
+			}
+			if point[1] < p.bounds.MinLat {
+				p.bounds.MinLat = point[1]
+			}
+			if point[1] > p.bounds.MaxLat {
+				p.bounds.MaxLat = point[1]
+			}
+		}
+	}
+	return p, nil
+}
+
+/*
+Contains reports whether location is inside polygon (inside an odd number of rings)
+*/
+func (p *Polygon) Contains(lat, lon float64) bool {
+	if !p.bounds.Contains(lat, lon) {
+		return false
+	}
+
+	inside := false
+	for _, ring := range p.Rings {
+		// ray casting (closed and unclosed rings)
+		j := len(ring) - 1
+		for i := range ring {
+			xi, yi := ring[i][0], ring[i][1]
+			xj, yj := ring[j][0], ring[j][1]
+			if (yi > lat) != (yj > lat) && lon < (xj-xi)*(lat-yi)/(yj-yi)+xi {
+				inside = !inside
+			}
+			j = i
+		}
+	}
+	return inside
+}
+
+/*
+String returns description of polygon
+*/
+func (p *Polygon) String() string {
+	return fmt.Sprintf("polygon %s (%d rings)", p.Name, len(p.Rings))
+}
+
+/*
+parsePoly parses polygon in Osmosis polygon format (name line, sections of "lon lat" lines ending
+with END, section name with prefix '!' = hole, final END)
+*/
+func parsePoly(r io.Reader) (*Polygon, error) {
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	name := ""
+	rings := [][][2]float64{}
+	var ring [][2]float64
+	inRing := false
+	complete := false
+
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case lineNumber == 1:
+			name = line
+		case line == "":
+			continue
+		case complete:
+			return nil, fmt.Errorf("line %d: data after final END", lineNumber)
+		case !inRing && line == "END":
+			complete = true
+		case !inRing:
+			inRing = true // section name (prefix '!' = hole, even-odd rule needs no distinction)
+			ring = [][2]float64{}
+		case line == "END":
+			rings = append(rings, ring)
+			inRing = false
+		default:
+			fields := strings.Fields(line)
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("line %d: 2 coordinates expected (lon lat)", lineNumber)
+			}
+			lon, err := strconv.ParseFloat(fields[0], 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid longitude: %v", lineNumber, err)
+			}
+			lat, err := strconv.ParseFloat(fields[1], 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid latitude: %v", lineNumber, err)
+			}
+			ring = append(ring, [2]float64{lon, lat})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !complete {
+		return nil, fmt.Errorf("final END missing")
+	}
+
+	return newPolygon(name, rings)
+}
+
+// geoJSONObject defines the parts of GeoJSON objects needed for polygons
+type geoJSONObject struct {
+	Type        string                 `json:"type"`
+	Features    []geoJSONObject        `json:"features"`
+	Geometry    *geoJSONObject         `json:"geometry"`
+	Properties  map[string]interface{} `json:"properties"`
+	Coordinates json.RawMessage        `json:"coordinates"`
+}
+
+/*
+parseGeoJSONPolygon parses GeoJSON polygon (Polygon, MultiPolygon, Feature or FeatureCollection)
+*/
+func parseGeoJSONPolygon(data []byte) (*Polygon, error) {
+	object := geoJSONObject{}
+	err := json.Unmarshal(data, &object)
+	if err != nil {
+		return nil, err
+	}
+
+	name := ""
+	rings := [][][2]float64{}
+	err = object.addRings(&rings, &name)
+	if err != nil {
+		return nil, err
+	}
+	return newPolygon(name, rings)
+}
+
+/*
+addRings adds rings of polygon geometries of GeoJSON object (name: from property 'name' of first feature)
+*/
+func (o *geoJSONObject) addRings(rings *[][][2]float64, name *string) error {
+	switch o.Type {
+	case "FeatureCollection":
+		for i := range o.Features {
+			err := o.Features[i].addRings(rings, name)
+			if err != nil {
+				return err
+			}
+		}
+	case "Feature":
+		if value, ok := o.Properties["name"].(string); ok && *name == "" {
+			*name = value
+		}
+		if o.Geometry != nil {
+			return o.Geometry.addRings(rings, name)
+		}
+	case "Polygon":
+		polygon := [][][2]float64{}
+		err := json.Unmarshal(o.Coordinates, &polygon)
+		if err != nil {
+			return fmt.Errorf("invalid Polygon coordinates: %v", err)
+		}
+		*rings = append(*rings, polygon...)
+	case "MultiPolygon":
+		multiPolygon := [][][][2]float64{}
+		err := json.Unmarshal(o.Coordinates, &multiPolygon)
+		if err != nil {
+			return fmt.Errorf("invalid MultiPolygon coordinates: %v", err)
+		}
+		for _, polygon := range multiPolygon {
+			*rings = append(*rings, polygon...)
+		}
+	default:
+		return fmt.Errorf("unsupported GeoJSON type '%s' (Polygon, MultiPolygon, Feature or FeatureCollection expected)", o.Type)
+	}
+	return nil
+}
+
+// clipper drops derived nodes outside clip area and counts them
+type clipper struct {
+	area  Area
+	stats ClipStats
+	extent
+}
+
+/*
+newClipper creates new clipper (nil = no clipping)
+*/
+func newClipper(area Area) *clipper {
+	if area == nil {
+		return nil
+	}
+	return &clipper{area: area, stats: ClipStats{Area: area.String()}, extent: newExtent()}
+}
+
+/*
+keep reports whether location is inside clip area (extends extent of kept nodes)
+*/
+func (c *clipper) keep(lat, lon float64) bool {
+	if !c.area.Contains(lat, lon) {
+		return false
+	}
+	c.extent.add(lat, lon)
+	return true
+}
+
+/*
+result returns clip statistics
+*/
+func (c *clipper) result() *ClipStats {
+	stats := c.stats
+	stats.LonMin, stats.LonMax = c.minLon, c.maxLon
+	stats.LatMin, stats.LatMax = c.minLat, c.maxLat
+	return &stats
+}
@@ -0,0 +1,133 @@
+/*
+Purpose:
+- Tests of clip areas (bounding box, polygon files)
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package process
+
+import (
+	"strings"
+	"testing"
+)
+
+/*
+TestParseBBox checks valid and invalid bounding boxes
+*/
+func TestParseBBox(t *testing.T) {
+	b, err := ParseBBox("5.8, 50.3,9.5,52.6")
+	if err != nil {
+		t.Fatalf("ParseBBox: %v", err)
+	}
+	if b != (BBox{MinLon: 5.8, MinLat: 50.3, MaxLon: 9.5, MaxLat: 52.6}) {
+		t.Errorf("ParseBBox = %+v", b)
+	}
+	if !b.Contains(51, 7) || !b.Contains(50.3, 5.8) || b.Contains(53, 7) || b.Contains(51, 10) {
+		t.Errorf("Contains: wrong result")
+	}
+
+	for _, value := range []string{"", "1,2,3", "1,2,3,4,5", "a,2,3,4", "3,2,1,4", "1,4,3,2", "-181,0,1,1", "0,-91,1,1"} {
+		if _, err := ParseBBox(value); err == nil {
+			t.Errorf("ParseBBox(%q): error expected", value)
+		}
+	}
+}
+
+// square with hole (same area in .poly and GeoJSON format)
+const (
+	testPoly = `testarea
+1
+   7.0 52.0
+   8.0 52.0
+   8.0 53.0
+   7.0 53.0
+END
+!2
+   7.4 52.4
+   7.6 52.4
+   7.6 52.6
+   7.4 52.6
+END
+END
+`
+	testGeoJSON = `{"type":"FeatureCollection","features":[{"type":"Feature","properties":{"name":"testarea"},
+"geometry":{"type":"Polygon","coordinates":[[[7,52],[8,52],[8,53],[7,53],[7,52]],[[7.4,52.4],[7.6,52.4],[7.6,52.6],[7.4,52.6],[7.4,52.4]]]}}]}`
+)
+
+/*
+TestPolygonContains checks polygon with hole in both file formats
+*/
+func TestPolygonContains(t *testing.T) {
+	fromPoly, err := parsePoly(strings.NewReader(testPoly))
+	if err != nil {
+		t.Fatalf("parsePoly: %v", err)
+	}
+	fromGeoJSON, err := parseGeoJSONPolygon([]byte(testGeoJSON))
+	if err != nil {
+		t.Fatalf("parseGeoJSONPolygon: %v", err)
+	}
+
+	tests := []struct {
+		lat, lon float64
+		inside   bool
+	}{
+		{52.2, 7.2, true},  // outer ring
+		{52.9, 7.9, true},  // outer ring
+		{52.5, 7.5, false}, // hole
+		{52.5, 8.5, false}, // east of polygon
+		{51.9, 7.5, false}, // south of polygon
+		{52.45, 7.3, true}, // between outer ring and hole
+	}
+	for _, polygon := range []*Polygon{fromPoly, fromGeoJSON} {
+		if polygon.Name != "testarea" || len(polygon.Rings) != 2 {
+			t.Errorf("polygon %s with %d rings, expected testarea with 2 rings", polygon.Name, len(polygon.Rings))
+		}
+		for _, test := range tests {
+			if got := polygon.Contains(test.lat, test.lon); got != test.inside {
+				t.Errorf("%s: Contains(%v, %v) = %v, expected %v", polygon, test.lat, test.lon, got, test.inside)
+			}
+		}
+	}
+}
+
+/*
+TestParsePolyErrors checks invalid .poly files
+*/
+func TestParsePolyErrors(t *testing.T) {
+	tests := map[string]string{
+		"final END missing":  "name\n1\n 7 52\n 8 52\n 8 53\nEND\n",
+		"invalid coordinate": "name\n1\n 7 x\n 8 52\n 8 53\nEND\nEND\n",
+		"3 coordinates":      "name\n1\n 7 52 1\n 8 52\n 8 53\nEND\nEND\n",
+		"too few points":     "name\n1\n 7 52\n 8 52\nEND\nEND\n",
+		"no rings":           "name\nEND\n",
+		"data after END":     "name\n1\n 7 52\n 8 52\n 8 53\nEND\nEND\n1\n",
+	}
+	for name, data := range tests {
+		if _, err := parsePoly(strings.NewReader(data)); err == nil {
+			t.Errorf("%s: error expected", name)
+		}
+	}
+}
+
+/*
+TestParseGeoJSONMultiPolygon checks MultiPolygon and unsupported types
+*/
+func TestParseGeoJSONMultiPolygon(t *testing.T) {
+	polygon, err := parseGeoJSONPolygon([]byte(`{"type":"MultiPolygon","coordinates":[[[[0,0],[1,0],[1,1],[0,0]]],[[[5,5],[6,5],[6,6],[5,5]]]]}`))
+	if err != nil {
+		t.Fatalf("parseGeoJSONPolygon: %v", err)
+	}
+	if len(polygon.Rings) != 2 || !polygon.Contains(0.2, 0.8) || !polygon.Contains(5.2, 5.8) || polygon.Contains(3, 3) {
+		t.Errorf("MultiPolygon: wrong rings or Contains result")
+	}
+
+	if _, err := parseGeoJSONPolygon([]byte(`{"type":"Point","coordinates":[1,2]}`)); err == nil {
+		t.Errorf("Point: error expected")
+	}
+}
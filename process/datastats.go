@@ -0,0 +1,190 @@
+/*
+Purpose:
+- OSM data statistics
+
+Description:
+- Collects the statistics of all objects of the input (counts, extent, timestamps, ID ranges, maximum
+  number of tags and references).
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package process
+
+import (
+	"math"
+	"time"
+
+	"github.com/paulmach/osm"
+)
+
+// osmDataCollector collects the OSM data statistics
+type osmDataCollector struct {
+	nodes, ways, relations int
+	elements               *elementStats
+
+	extent
+	minTS, maxTS time.Time
+
+	maxNodeRefs   int
+	maxNodeRefsID osm.WayID
+	maxRelRefs    int
+	maxRelRefsID  osm.RelationID
+}
+
+/*
+newOSMDataCollector creates new OSM data statistics collector
+*/
+func newOSMDataCollector() *osmDataCollector {
+	return &osmDataCollector{
+		elements: newElementStats(),
+		extent:   newExtent(),
+		minTS:    time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+// extent tracks the min/max coordinates of nodes
+type extent struct {
+	minLat, maxLat float64
+	minLon, maxLon float64
+}
+
+/*
+newExtent creates new (empty) extent
+*/
+func newExtent() extent {
+	return extent{minLat: math.MaxFloat64, maxLat: -math.MaxFloat64, minLon: math.MaxFloat64, maxLon: -math.MaxFloat64}
+}
+
+/*
+add extends extent by coordinates
+*/
+func (e *extent) add(lat, lon float64) {
+	if lat > e.maxLat {
+		e.maxLat = lat
+	}
+	if lat < e.minLat {
+		e.minLat = lat
+	}
+	if lon > e.maxLon {
+		e.maxLon = lon
+	}
+	if lon < e.minLon {
+		e.minLon = lon
+	}
+}
+
+/*
+add adds object to statistics
+*/
+func (c *osmDataCollector) add(object osm.Object) {
+	var ts time.Time
+
+	switch e := object.(type) {
+	case *osm.Node:
+		c.nodes++
+		ts = e.Timestamp
+		c.elements.Add(e.ElementID(), e.Tags)
+		c.extent.add(e.Lat, e.Lon)
+
+	case *osm.Way:
+		c.ways++
+		ts = e.Timestamp
+		c.elements.Add(e.ElementID(), e.Tags)
+
+		if l := len(e.Nodes); l > c.maxNodeRefs {
+			c.maxNodeRefs = l
+			c.maxNodeRefsID = e.ID
+		}
+
+	case *osm.Relation:
+		c.relations++
+		ts = e.Timestamp
+		c.elements.Add(e.ElementID(), e.Tags)
+
+		if l := len(e.Members); l > c.maxRelRefs {
+			c.maxRelRefs = l
+			c.maxRelRefsID = e.ID
+		}
+
+	default:
+		return // other objects (e.g. bounds) have no timestamp
+	}
+
+	if ts.After(c.maxTS) {
+		c.maxTS = ts
+	}
+
+	if ts.Before(c.minTS) {
+		c.minTS = ts
+	}
+}
+
+/*
+stats returns OSM data statistics
+*/
+func (c *osmDataCollector) stats() OSMDataStats {
+	return OSMDataStats{
+		TimestampMin: c.minTS,
+		TimestampMax: c.maxTS,
+		LonMin:       c.minLon,
+		LonMax:       c.maxLon,
+		LatMin:       c.minLat,
+		LatMax:       c.maxLat,
+		Nodes:        c.nodes,
+		Ways:         c.ways,
+		Relations:    c.relations,
+		VersionMax:   c.elements.MaxVersion,
+		IDRanges: map[string]*IDRange{
+			"node":     c.elements.Ranges[osm.TypeNode],
+			"way":      c.elements.Ranges[osm.TypeWay],
+			"relation": c.elements.Ranges[osm.TypeRelation],
+		},
+		KeyvalPairsMax:       c.elements.MaxTags,
+		KeyvalPairsMaxObject: ObjectRef{Type: string(c.elements.MaxTagsID.Type()), ID: c.elements.MaxTagsID.Ref()},
+		NoderefsMax:          c.maxNodeRefs,
+		NoderefsMaxObject:    ObjectRef{Type: string(osm.TypeWay), ID: int64(c.maxNodeRefsID)},
+		RelrefsMax:           c.maxRelRefs,
+		RelrefsMaxObject:     ObjectRef{Type: string(osm.TypeRelation), ID: int64(c.maxRelRefsID)},
+	}
+}
+
+// elementStats is a shared bit of code to accumulate stats from the element ids.
+type elementStats struct {
+	Ranges     map[osm.Type]*IDRange
+	MaxVersion int
+	MaxTags    int
+	MaxTagsID  osm.ElementID
+}
+
+/*
+newElementStats creates new elements static map
+*/
+func newElementStats() *elementStats {
+	return &elementStats{
+		Ranges: map[osm.Type]*IDRange{
+			osm.TypeNode:     {Min: math.MaxInt64},
+			osm.TypeWay:      {Min: math.MaxInt64},
+			osm.TypeRelation: {Min: math.MaxInt64},
+		},
+	}
+}
+
+/*
+Add adds max version and max tags
+*/
+func (s *elementStats) Add(id osm.ElementID, tags osm.Tags) {
+	s.Ranges[id.Type()].Add(id.Ref())
+	if v := id.Version(); v > s.MaxVersion {
+		s.MaxVersion = v
+	}
+	if l := len(tags); l > s.MaxTags {
+		s.MaxTags = l
+		s.MaxTagsID = id
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Purpose:
+- Skipping of derived nodes already written in an earlier run
+
+Description:
+- Several input files written to one combined output may overlap (e.g. extracts of neighbouring
+  states share the border area). Without de-duplication the new nodes of a shared junction are
+  created twice (ID scheme 'source': twice with the same ID) and shared point objects are written
+  twice as modified nodes.
+- New nodes are skipped if their source node was processed in an earlier run, modified nodes if
+  their ID was written in an earlier run.
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package process
+
+import (
+	"github.com/paulmach/osm"
+)
+
+// duplicates remembers the source nodes of derived nodes across runs
+type duplicates struct {
+	newSources     map[osm.NodeID]bool // source nodes of new nodes of earlier runs
+	currentSources map[osm.NodeID]bool // source nodes of new nodes of current run
+	modified       map[osm.NodeID]bool // modified nodes written (all runs)
+	stats          DuplicateStats
+}
+
+/*
+newDuplicates creates new de-duplication of derived nodes
+*/
+func newDuplicates() *duplicates {
+	return &duplicates{
+		newSources:     make(map[osm.NodeID]bool),
+		currentSources: make(map[osm.NodeID]bool),
+		modified:       make(map[osm.NodeID]bool),
+	}
+}
+
+/*
+begin prepares new run
+*/
+func (d *duplicates) begin() {
+	d.stats = DuplicateStats{}
+}
+
+/*
+keepNew reports whether new node of source node is written (source not processed in an earlier run)
+*/
+func (d *duplicates) keepNew(source osm.NodeID) bool {
+	if d.newSources[source] {
+		d.stats.NewNodes++
+		return false
+	}
+	d.currentSources[source] = true
+	return true
+}
+
+/*
+keepModified reports whether modified node is written (not written in an earlier run)
+*/
+func (d *duplicates) keepModified(id osm.NodeID) bool {
+	if d.modified[id] {
+		d.stats.ModifiedNodes++
+		return false
+	}
+	d.modified[id] = true
+	return true
+}
+
+/*
+end completes run (source nodes of current run become source nodes of earlier runs)
+*/
+func (d *duplicates) end() *DuplicateStats {
+	for id := range d.currentSources {
+		d.newSources[id] = true
+	}
+	d.currentSources = make(map[osm.NodeID]bool)
+	stats := d.stats
+	return &stats
+}
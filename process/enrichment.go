@@ -0,0 +1,582 @@
+/*
+Purpose:
+- Point-on-way enrichment
+
+Description:
+- Enriches point objects (e.g. highway=turning_circle, highway=mini_roundabout) with the class of the
+  way they sit on (e.g. "fzk_turning=residential"). If more than one way matches, the way class with
+  the highest priority wins (independent of the order of ways).
+- Collects the ways ending at (or passing) point objects and the coordinates of the neighbouring way nodes.
+- For dead-end point objects (exactly one way ends at the node) the bearing of the last way segment
+  is written as tag "<outputKey>:direction" (degrees, 0 = north, 90 = east).
+- The position of point objects is classified as "end" (end of way), "middle" (mid-way, usually a
+  tagging error or turning bay for turning circles) or "orphan" (no matching way) and written as
+  tag "<outputKey>:position".
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package process
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/paulmach/osm"
+)
+
+// pointEnrichment holds the point objects of one enrichment rule
+type pointEnrichment struct {
+	Rule       *PointEnrichmentRule
+	Nodes      map[osm.NodeID]*osm.Node    // point objects
+	Geometries map[osm.NodeID]*wayGeometry // ways touching point objects (nil = disabled)
+	Objects    map[osm.NodeID]string       // matching node tag per point object (e.g. "highway=turning_circle", only with geometry)
+	Found      []int                       // point objects found per node tag selector
+	Added      int                         // way classes added
+	Replaced   int                         // way classes replaced by higher ranked class
+
+	AllClasses bool              // record all way classes in tag "<outputKey>:all"
+	Locations  NodeLocationStore // node location lookup for neighbouring way nodes (nil = disabled)
+}
+
+// wayGeometry holds the ways touching one point object
+type wayGeometry struct {
+	WayEnds   int           // number of ways ending at node
+	WayMiddle int           // number of ways passing node
+	Neighbors []wayNeighbor // neighbouring way nodes (way ends only)
+}
+
+// wayNeighbor defines the neighbouring way node of a point object
+type wayNeighbor struct {
+	ID       osm.NodeID
+	Lat, Lon float64
+	Found    bool // coordinates found in node location lookup
+}
+
+// positions of point objects (on matching ways)
+const (
+	PositionEnd    = "end"
+	PositionMiddle = "middle"
+	PositionOrphan = "orphan"
+)
+
+// value of output tag if no matching way exists
+const notSet = "not_set"
+
+// pointEnrichmentStep holds the state of processing step 'point_enrichment' (all enrichment rules)
+type pointEnrichmentStep struct {
+	ctx         *StepContext
+	enrichments []*pointEnrichment
+	points      []PointStats
+
+	// multi-pass: nodes and ways, neighbouring way nodes (only with directions), point objects
+	multiPass    bool
+	pass         int                           // current pass
+	pointObjects map[osm.NodeID]*osm.Node      // ID, location and tags of point objects
+	neighbors    map[osm.NodeID][]*wayNeighbor // neighbouring way nodes waiting for their location
+}
+
+/*
+newPointEnrichments creates point-on-way enrichments for all rules
+*/
+func newPointEnrichments(rs *RuleSet, withGeometry, allClasses bool, locations NodeLocationStore) []*pointEnrichment {
+	enrichments := []*pointEnrichment{}
+	for i := range rs.PointEnrichments {
+		pe := &pointEnrichment{
+			Rule:  &rs.PointEnrichments[i],
+			Nodes: make(map[osm.NodeID]*osm.Node),
+			Found: make([]int, len(rs.PointEnrichments[i].NodeTags)),
+
+			AllClasses: allClasses,
+			Locations:  locations,
+		}
+		if withGeometry {
+			pe.Geometries = make(map[osm.NodeID]*wayGeometry)
+			pe.Objects = make(map[osm.NodeID]string)
+		}
+		enrichments = append(enrichments, pe)
+	}
+	return enrichments
+}
+
+/*
+newPointEnrichmentStep creates processing step 'point_enrichment'
+*/
+func newPointEnrichmentStep(ctx *StepContext) Step {
+	opts := ctx.Options
+	withGeometry := opts.PointDirection || opts.PointPosition || opts.PointQA
+	s := &pointEnrichmentStep{
+		ctx:         ctx,
+		enrichments: newPointEnrichments(ctx.Rules, withGeometry, opts.PointAll, ctx.Locations),
+		points:      []PointStats{},
+		multiPass:   opts.MultiPass,
+	}
+	if s.multiPass {
+		s.pointObjects = make(map[osm.NodeID]*osm.Node)
+	}
+	return s
+}
+
+/*
+Passes returns passes of step (multi-pass: nodes and ways, nodes for directions, nodes for output)
+*/
+func (s *pointEnrichmentStep) Passes() []Pass {
+	if !s.multiPass {
+		return []Pass{PassAll}
+	}
+	passes := []Pass{{Nodes: true, Ways: true}}
+	if s.ctx.Options.PointDirection {
+		passes = append(passes, PassNodes)
+	}
+	return append(passes, PassNodes)
+}
+
+/*
+EndPass prepares next pass
+*/
+func (s *pointEnrichmentStep) EndPass(pass int) error {
+	passes := s.Passes()
+	if pass == 0 && len(passes) == 3 {
+		// locations of neighbouring way nodes are collected in next pass
+		s.neighbors = make(map[osm.NodeID][]*wayNeighbor)
+		for _, pe := range s.enrichments {
+			for _, geometry := range pe.Geometries {
+				for i := range geometry.Neighbors {
+					neighbor := &geometry.Neighbors[i]
+					s.neighbors[neighbor.ID] = append(s.neighbors[neighbor.ID], neighbor)
+				}
+			}
+		}
+	}
+	if pass == len(passes)-2 {
+		s.neighbors = nil
+		s.complete()
+	}
+	s.pass = pass + 1
+	return nil
+}
+
+/*
+Node stores node as point object of all matching enrichment rules
+*/
+func (s *pointEnrichmentStep) Node(node *osm.Node) error {
+	if s.pass > 0 {
+		return s.nodeLaterPass(node)
+	}
+	if len(node.Tags) == 0 {
+		return nil
+	}
+
+	tags := node.TagMap()
+	var point *osm.Node
+	for _, pe := range s.enrichments {
+		if pe.Rule.matchNode(tags) < 0 {
+			continue
+		}
+		if point == nil {
+			point = s.pointObject(node)
+		}
+		pe.addNode(point, tags)
+	}
+	return nil
+}
+
+/*
+pointObject returns object to be enriched (multi-pass: ID, location and tags only, metadata is added when written)
+*/
+func (s *pointEnrichmentStep) pointObject(node *osm.Node) *osm.Node {
+	if !s.multiPass {
+		return node
+	}
+	point, found := s.pointObjects[node.ID]
+	if !found {
+		point = &osm.Node{ID: node.ID, Lat: node.Lat, Lon: node.Lon, Tags: append(osm.Tags{}, node.Tags...)}
+		s.pointObjects[node.ID] = point
+	}
+	return point
+}
+
+/*
+nodeLaterPass sets location of neighbouring way node or writes point object (multi-pass)
+*/
+func (s *pointEnrichmentStep) nodeLaterPass(node *osm.Node) error {
+	if s.neighbors != nil {
+		for _, neighbor := range s.neighbors[node.ID] {
+			neighbor.Lat, neighbor.Lon, neighbor.Found = node.Lat, node.Lon, true
+		}
+		return nil
+	}
+
+	point, found := s.pointObjects[node.ID]
+	if !found || !s.ctx.KeepModifiedNode(point) {
+		return nil
+	}
+	modified := *node
+	modified.Tags = point.Tags
+	err := s.ctx.Writer.WriteModifiedNode(&modified)
+	if err != nil {
+		return fmt.Errorf("error writing modified node: %v", err)
+	}
+	return nil
+}
+
+/*
+Way adds way class to point objects (e.g. highway type to turning_circle/loop node)
+*/
+func (s *pointEnrichmentStep) Way(way *osm.Way) error {
+	if len(way.Tags) == 0 {
+		return nil
+	}
+	tags := way.TagMap()
+	for _, pe := range s.enrichments {
+		pe.addWay(way, tags)
+	}
+	return nil
+}
+
+/*
+Relation does nothing (point objects are independent of relations)
+*/
+func (s *pointEnrichmentStep) Relation(relation *osm.Relation) error {
+	return nil
+}
+
+/*
+Finish adds direction and position to point objects and writes them as modified nodes (multi-pass: already written)
+*/
+func (s *pointEnrichmentStep) Finish() error {
+	if s.multiPass {
+		return nil
+	}
+	s.complete()
+
+	// write/duplicate point objects (with unmodified ID, PBF: replacing the original objects)
+	// a point object matching more than one enrichment rule is written only once (sorted by ID)
+	modifiedNodes := make(map[osm.NodeID]*osm.Node)
+	for _, pe := range s.enrichments {
+		for id, value := range pe.Nodes {
+			if _, found := modifiedNodes[id]; !found {
+				modifiedNodes[id] = value
+			}
+		}
+	}
+	modifiedIDs := make([]osm.NodeID, 0, len(modifiedNodes))
+	for id := range modifiedNodes {
+		modifiedIDs = append(modifiedIDs, id)
+	}
+	sort.Slice(modifiedIDs, func(i, j int) bool { return modifiedIDs[i] < modifiedIDs[j] })
+	for _, id := range modifiedIDs {
+		if !s.ctx.KeepModifiedNode(modifiedNodes[id]) {
+			continue
+		}
+		err := s.ctx.Writer.WriteModifiedNode(modifiedNodes[id])
+		if err != nil {
+			return fmt.Errorf("error writing modified node: %v", err)
+		}
+	}
+
+	return nil
+}
+
+/*
+complete adds direction, position and missing class to point objects (and collects statistics)
+*/
+func (s *pointEnrichmentStep) complete() {
+	for _, pe := range s.enrichments {
+		directionsAdded := 0
+		if s.ctx.Options.PointDirection {
+			for _, value := range pe.Nodes {
+				if pe.addDirection(value) {
+					directionsAdded++
+				}
+			}
+		}
+		positionStatistic := make(map[string]int)
+		if pe.Geometries != nil {
+			for _, value := range pe.Nodes {
+				positionStatistic[pe.position(value.ID)]++
+				if s.ctx.Options.PointPosition {
+					pe.addPosition(value)
+				}
+			}
+		}
+
+		ps := PointStats{
+			Name:            pe.Rule.Name,
+			OutputKey:       pe.Rule.OutputKey,
+			Found:           make(map[string]int),
+			Total:           len(pe.Nodes),
+			TypesAdded:      pe.Added,
+			TypesReplaced:   pe.Replaced,
+			DirectionsAdded: directionsAdded,
+			Classes:         pe.classStatistic(),
+		}
+		for i, selector := range pe.Rule.NodeTags {
+			ps.Found[selector.Label()] += pe.Found[i]
+		}
+		if pe.Geometries != nil {
+			ps.Positions = positionStatistic
+		}
+		s.points = append(s.points, ps)
+	}
+
+	for _, pe := range s.enrichments {
+		pe.setMissingClass()
+	}
+}
+
+/*
+Stats adds point object statistics (and mid-way/orphaned point objects) to result
+*/
+func (s *pointEnrichmentStep) Stats(result *Result) {
+	result.Points = append(result.Points, s.points...)
+	if s.ctx.Options.PointQA {
+		result.PointIssues = pointIssues(s.enrichments)
+	}
+}
+
+/*
+pointIssues returns mid-way and orphaned point objects (sorted by ID per enrichment)
+*/
+func pointIssues(enrichments []*pointEnrichment) []PointIssue {
+	issues := []PointIssue{}
+
+	for _, pe := range enrichments {
+		nodes := []*osm.Node{}
+		for _, node := range pe.Nodes {
+			if pe.position(node.ID) != PositionEnd {
+				nodes = append(nodes, node)
+			}
+		}
+		sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+
+		for _, node := range nodes {
+			issues = append(issues, PointIssue{NodeID: node.ID, Lat: node.Lat, Lon: node.Lon, Object: pe.Objects[node.ID], Position: pe.position(node.ID)})
+		}
+	}
+
+	return issues
+}
+
+/*
+addNode stores node as point object (if node matches one of the node tag selectors)
+*/
+func (pe *pointEnrichment) addNode(node *osm.Node, tags map[string]string) bool {
+	i := pe.Rule.matchNode(tags)
+	if i < 0 {
+		return false
+	}
+	pe.Found[i]++
+	pe.Nodes[node.ID] = node
+	if pe.Objects != nil {
+		selector := pe.Rule.NodeTags[i]
+		pe.Objects[node.ID] = selector.Key + "=" + tags[selector.Key]
+	}
+	return true
+}
+
+/*
+addWay adds way class to all point objects which are part of the way (if way matches way filter)
+*/
+func (pe *pointEnrichment) addWay(way *osm.Way, tags map[string]string) {
+	wayClass, found := tags[pe.Rule.WayKey]
+	if !found || pe.Rule.rank(wayClass) < 0 {
+		return
+	}
+
+	added, replaced := addWayClassToPoints(way, pe.Nodes, pe.Rule, wayClass, pe.AllClasses)
+	pe.Added += added
+	pe.Replaced += replaced
+
+	if pe.Geometries != nil {
+		pe.addGeometry(way)
+	}
+}
+
+/*
+addWayClassToPoints adds way class to point objects (e.g. "fzk_turning=living_street")
+- a point object can be part of more than one way (e.g. residential + footway)
+- a higher ranked way class replaces a lower ranked one (independent of the order of ways)
+- with allClasses all way classes are recorded in tag "<outputKey>:all"
+*/
+func addWayClassToPoints(e *osm.Way, points map[osm.NodeID]*osm.Node, rule *PointEnrichmentRule, wayClass string, allClasses bool) (int, int) {
+	added, replaced := 0, 0
+	rank := rule.rank(wayClass)
+
+	for _, node := range e.Nodes {
+		// try to find point object for each node (do not break loop processing)
+		value, ok := points[node.ID]
+		if !ok {
+			continue
+		}
+
+		// check if output tag already exists
+		outputTagFound := false
+		for i, tag := range value.Tags {
+			if tag.Key == rule.OutputKey {
+				outputTagFound = true
+				if rank < rule.rank(tag.Value) {
+					value.Tags[i].Value = wayClass
+					replaced++
+				}
+				break
+			}
+		}
+		if !outputTagFound {
+			outputTag := osm.Tag{Key: rule.OutputKey, Value: wayClass}
+			value.Tags = append(value.Tags, outputTag)
+			added++
+		}
+
+		if allClasses {
+			addWayClass(value, rule, wayClass)
+		}
+	}
+
+	return added, replaced
+}
+
+/*
+addWayClass records way class in tag "<outputKey>:all" (e.g. "residential;service", ordered by rank)
+*/
+func addWayClass(node *osm.Node, rule *PointEnrichmentRule, wayClass string) {
+	allKey := rule.OutputKey + ":all"
+	for i, tag := range node.Tags {
+		if tag.Key != allKey {
+			continue
+		}
+		classes := strings.Split(tag.Value, ";")
+		for _, class := range classes {
+			if class == wayClass {
+				return
+			}
+		}
+		classes = append(classes, wayClass)
+		sort.SliceStable(classes, func(a, b int) bool {
+			return rule.rank(classes[a]) < rule.rank(classes[b])
+		})
+		node.Tags[i].Value = strings.Join(classes, ";")
+		return
+	}
+
+	node.Tags = append(node.Tags, osm.Tag{Key: allKey, Value: wayClass})
+}
+
+/*
+addGeometry registers way for all point objects which are part of the way
+*/
+func (pe *pointEnrichment) addGeometry(way *osm.Way) {
+	last := len(way.Nodes) - 1
+	if last < 1 {
+		return
+	}
+
+	for i, node := range way.Nodes {
+		if _, found := pe.Nodes[node.ID]; !found {
+			continue
+		}
+		geometry, found := pe.Geometries[node.ID]
+		if !found {
+			geometry = &wayGeometry{}
+			pe.Geometries[node.ID] = geometry
+		}
+
+		// closed ways (first node == last node) have no dead end
+		if (i != 0 && i != last) || way.Nodes[0].ID == way.Nodes[last].ID {
+			geometry.WayMiddle++
+			continue
+		}
+
+		geometry.WayEnds++
+		neighborID := way.Nodes[1].ID
+		if i == last {
+			neighborID = way.Nodes[last-1].ID
+		}
+		neighbor := wayNeighbor{ID: neighborID}
+		if pe.Locations != nil {
+			neighbor.Lat, neighbor.Lon, neighbor.Found = pe.Locations.Get(neighborID)
+		}
+		geometry.Neighbors = append(geometry.Neighbors, neighbor)
+	}
+}
+
+/*
+position classifies position of point object (end of way, mid-way or orphan)
+*/
+func (pe *pointEnrichment) position(id osm.NodeID) string {
+	geometry, found := pe.Geometries[id]
+	switch {
+	case !found:
+		return PositionOrphan
+	case geometry.WayEnds > 0:
+		return PositionEnd
+	case geometry.WayMiddle > 0:
+		return PositionMiddle
+	}
+	return PositionOrphan
+}
+
+/*
+addPosition adds tag "<outputKey>:position" to point object
+*/
+func (pe *pointEnrichment) addPosition(node *osm.Node) string {
+	position := pe.position(node.ID)
+	node.Tags = append(node.Tags, osm.Tag{Key: pe.Rule.OutputKey + ":position", Value: position})
+
+	return position
+}
+
+/*
+addDirection adds tag "<outputKey>:direction" to dead-end point object
+*/
+func (pe *pointEnrichment) addDirection(node *osm.Node) bool {
+	geometry, found := pe.Geometries[node.ID]
+	if !found || geometry.WayEnds != 1 || geometry.WayMiddle != 0 {
+		return false
+	}
+	neighbor := geometry.Neighbors[0]
+	if !neighbor.Found {
+		return false
+	}
+
+	// direction of travel along the last way segment (towards the point object)
+	bearing := initialBearing(neighbor.Lat, neighbor.Lon, node.Lat, node.Lon)
+	direction := int(math.Round(bearing)) % 360
+	node.Tags = append(node.Tags, osm.Tag{Key: pe.Rule.OutputKey + ":direction", Value: strconv.Itoa(direction)})
+
+	return true
+}
+
+/*
+classStatistic counts point objects per way class (e.g. "residential": 17, "not_set": 3)
+*/
+func (pe *pointEnrichment) classStatistic() map[string]int {
+	statistic := make(map[string]int)
+	for _, value := range pe.Nodes {
+		wayClass := value.Tags.Find(pe.Rule.OutputKey)
+		if wayClass == "" {
+			wayClass = notSet
+		}
+		statistic[wayClass]++
+	}
+	return statistic
+}
+
+/*
+setMissingClass adds tag "<outputKey>=not_set" to all point objects without way class
+*/
+func (pe *pointEnrichment) setMissingClass() {
+	for _, value := range pe.Nodes {
+		if value.Tags.Find(pe.Rule.OutputKey) == "" {
+			value.Tags = append(value.Tags, osm.Tag{Key: pe.Rule.OutputKey, Value: notSet})
+		}
+	}
+}
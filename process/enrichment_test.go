@@ -0,0 +1,175 @@
+/*
+Purpose:
+- Tests of processing step 'point_enrichment'
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package process
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/paulmach/osm"
+)
+
+/*
+pointObjects returns turning circle (node 1) and neighbouring nodes (2 north, 3 east, 4 south) followed by ways
+*/
+func pointObjects(ways ...*osm.Way) func() []osm.Object {
+	return func() []osm.Object {
+		objects := []osm.Object{
+			testNode(1, 52.0, 7.0, "highway", "turning_circle"),
+			testNode(2, 52.001, 7.0),
+			testNode(3, 52.0, 7.001),
+			testNode(4, 51.999, 7.0),
+		}
+		for _, way := range ways {
+			objects = append(objects, way)
+		}
+		return objects
+	}
+}
+
+/*
+TestPointEnrichmentStep checks tags of point object (single-pass and multi-pass)
+*/
+func TestPointEnrichmentStep(t *testing.T) {
+	service := testWay(101, []osm.NodeID{2, 1}, "highway", "service")
+	residential := testWay(102, []osm.NodeID{3, 1}, "highway", "residential")
+	track := testWay(103, []osm.NodeID{4, 1}, "highway", "track")
+	footway := testWay(104, []osm.NodeID{2, 1}, "highway", "footway")
+	reversed := testWay(105, []osm.NodeID{1, 2}, "highway", "service")
+	middle := testWay(106, []osm.NodeID{2, 1, 4}, "highway", "service")
+	closed := testWay(107, []osm.NodeID{1, 2, 3, 1}, "highway", "service")
+
+	tests := []struct {
+		name    string
+		opts    Options
+		objects func() []osm.Object
+		tags    osm.Tags // tags of modified node 1
+	}{
+		// way class priority (independent of order of ways)
+		{"service, residential", Options{}, pointObjects(service, residential),
+			osm.Tags{{Key: "highway", Value: "turning_circle"}, {Key: "fzk_turning", Value: "residential"}}},
+		{"residential, service", Options{}, pointObjects(residential, service),
+			osm.Tags{{Key: "highway", Value: "turning_circle"}, {Key: "fzk_turning", Value: "residential"}}},
+		{"track, service", Options{}, pointObjects(track, service),
+			osm.Tags{{Key: "highway", Value: "turning_circle"}, {Key: "fzk_turning", Value: "service"}}},
+		{"way class not in rule", Options{}, pointObjects(footway),
+			osm.Tags{{Key: "highway", Value: "turning_circle"}, {Key: "fzk_turning", Value: notSet}}},
+
+		// all way classes (ordered by priority)
+		{"all: service, residential", Options{PointAll: true}, pointObjects(service, residential),
+			osm.Tags{{Key: "highway", Value: "turning_circle"}, {Key: "fzk_turning", Value: "residential"}, {Key: "fzk_turning:all", Value: "residential;service"}}},
+		{"all: track, residential, service", Options{PointAll: true}, pointObjects(track, residential, service),
+			osm.Tags{{Key: "highway", Value: "turning_circle"}, {Key: "fzk_turning", Value: "residential"}, {Key: "fzk_turning:all", Value: "residential;service;track"}}},
+		{"all: way class not in rule", Options{PointAll: true}, pointObjects(service, footway),
+			osm.Tags{{Key: "highway", Value: "turning_circle"}, {Key: "fzk_turning", Value: "service"}, {Key: "fzk_turning:all", Value: "service"}}},
+
+		// direction of last way segment (dead end only)
+		{"direction: from north", Options{PointDirection: true}, pointObjects(service),
+			osm.Tags{{Key: "highway", Value: "turning_circle"}, {Key: "fzk_turning", Value: "service"}, {Key: "fzk_turning:direction", Value: "180"}}},
+		{"direction: from east", Options{PointDirection: true}, pointObjects(residential),
+			osm.Tags{{Key: "highway", Value: "turning_circle"}, {Key: "fzk_turning", Value: "residential"}, {Key: "fzk_turning:direction", Value: "270"}}},
+		{"direction: way starting at point", Options{PointDirection: true}, pointObjects(reversed),
+			osm.Tags{{Key: "highway", Value: "turning_circle"}, {Key: "fzk_turning", Value: "service"}, {Key: "fzk_turning:direction", Value: "180"}}},
+		{"direction: sorted node location store", Options{PointDirection: true, LocationStore: LocationStoreSorted}, pointObjects(residential),
+			osm.Tags{{Key: "highway", Value: "turning_circle"}, {Key: "fzk_turning", Value: "residential"}, {Key: "fzk_turning:direction", Value: "270"}}},
+		{"direction: two way ends", Options{PointDirection: true}, pointObjects(service, residential),
+			osm.Tags{{Key: "highway", Value: "turning_circle"}, {Key: "fzk_turning", Value: "residential"}}},
+		{"direction: mid-way", Options{PointDirection: true}, pointObjects(middle),
+			osm.Tags{{Key: "highway", Value: "turning_circle"}, {Key: "fzk_turning", Value: "service"}}},
+
+		// position on matching ways (end, middle, orphan)
+		{"position: end", Options{PointPosition: true}, pointObjects(service),
+			osm.Tags{{Key: "highway", Value: "turning_circle"}, {Key: "fzk_turning", Value: "service"}, {Key: "fzk_turning:position", Value: PositionEnd}}},
+		{"position: end and middle", Options{PointPosition: true}, pointObjects(middle, residential),
+			osm.Tags{{Key: "highway", Value: "turning_circle"}, {Key: "fzk_turning", Value: "residential"}, {Key: "fzk_turning:position", Value: PositionEnd}}},
+		{"position: middle", Options{PointPosition: true}, pointObjects(middle),
+			osm.Tags{{Key: "highway", Value: "turning_circle"}, {Key: "fzk_turning", Value: "service"}, {Key: "fzk_turning:position", Value: PositionMiddle}}},
+		{"position: closed way", Options{PointPosition: true}, pointObjects(closed),
+			osm.Tags{{Key: "highway", Value: "turning_circle"}, {Key: "fzk_turning", Value: "service"}, {Key: "fzk_turning:position", Value: PositionMiddle}}},
+		{"position: orphan", Options{PointPosition: true}, pointObjects(),
+			osm.Tags{{Key: "highway", Value: "turning_circle"}, {Key: "fzk_turning:position", Value: PositionOrphan}, {Key: "fzk_turning", Value: notSet}}},
+		{"position: way class not in rule", Options{PointPosition: true}, pointObjects(footway),
+			osm.Tags{{Key: "highway", Value: "turning_circle"}, {Key: "fzk_turning:position", Value: PositionOrphan}, {Key: "fzk_turning", Value: notSet}}},
+	}
+
+	for _, test := range tests {
+		for _, multiPass := range []bool{false, true} {
+			opts := test.opts
+			opts.Processors = []string{StepPointEnrichment}
+			opts.MultiPass = multiPass
+			_, collector := runTestProcessor(t, opts, test.objects)
+			if len(collector.modifiedNodes) != 1 {
+				t.Errorf("%s (multi-pass %v): %d modified nodes, expected 1", test.name, multiPass, len(collector.modifiedNodes))
+				continue
+			}
+			tags := collector.modifiedNodes[0].Tags
+			if !reflect.DeepEqual(tags, test.tags) {
+				t.Errorf("%s (multi-pass %v): tags %v, expected %v", test.name, multiPass, tags, test.tags)
+			}
+		}
+	}
+}
+
+/*
+TestPointEnrichmentStats counts added and replaced way classes
+*/
+func TestPointEnrichmentStats(t *testing.T) {
+	objects := pointObjects(
+		testWay(101, []osm.NodeID{2, 1}, "highway", "track"),
+		testWay(102, []osm.NodeID{3, 1}, "highway", "service"),
+		testWay(103, []osm.NodeID{4, 1}, "highway", "residential"),
+		testWay(104, []osm.NodeID{2, 1}, "highway", "living_street"),
+	)
+	result, _ := runTestProcessor(t, Options{Processors: []string{StepPointEnrichment}}, objects)
+	if len(result.Points) != 1 {
+		t.Fatalf("%d point statistics, expected 1", len(result.Points))
+	}
+	points := result.Points[0]
+	if points.Total != 1 || points.TypesAdded != 1 || points.TypesReplaced != 2 {
+		t.Errorf("total %d, added %d, replaced %d, expected 1, 1, 2", points.Total, points.TypesAdded, points.TypesReplaced)
+	}
+	if !reflect.DeepEqual(points.Classes, map[string]int{"residential": 1}) {
+		t.Errorf("classes %v, expected residential: 1", points.Classes)
+	}
+}
+
+/*
+TestPointIssues reports mid-way and orphaned point objects
+*/
+func TestPointIssues(t *testing.T) {
+	objects := func() []osm.Object {
+		return []osm.Object{
+			testNode(1, 52.0, 7.0, "highway", "turning_circle"),
+			testNode(2, 52.001, 7.0),
+			testNode(3, 52.0, 7.001, "highway", "turning_loop"),
+			testNode(4, 51.999, 7.0),
+			testNode(5, 52.1, 7.1, "highway", "turning_circle"),
+			testWay(101, []osm.NodeID{2, 1}, "highway", "service"),
+			testWay(102, []osm.NodeID{2, 3, 4}, "highway", "residential"),
+		}
+	}
+	for _, multiPass := range []bool{false, true} {
+		result, _ := runTestProcessor(t, Options{Processors: []string{StepPointEnrichment}, PointQA: true, MultiPass: multiPass}, objects)
+		expected := []PointIssue{
+			{NodeID: 3, Lat: 52.0, Lon: 7.001, Object: "highway=turning_loop", Position: PositionMiddle},
+			{NodeID: 5, Lat: 52.1, Lon: 7.1, Object: "highway=turning_circle", Position: PositionOrphan},
+		}
+		if !reflect.DeepEqual(result.PointIssues, expected) {
+			t.Errorf("multi-pass %v: issues %+v, expected %+v", multiPass, result.PointIssues, expected)
+		}
+		positions := map[string]int{PositionEnd: 1, PositionMiddle: 1, PositionOrphan: 1}
+		if !reflect.DeepEqual(result.Points[0].Positions, positions) {
+			t.Errorf("multi-pass %v: positions %v, expected %v", multiPass, result.Points[0].Positions, positions)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+/*
+Purpose:
+- Geodetic helper functions
+
+Description:
+- Calculations on a spherical earth model (sufficient for short distances).
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package process
+
+import (
+	"math"
+)
+
+// mean earth radius in meters
+const earthRadius = 6371008.8
+
+/*
+destinationPoint calculates point at distance (meters) and bearing (degrees) from start point
+*/
+func destinationPoint(lat, lon, distance, bearing float64) (float64, float64) {
+	phi1 := lat * math.Pi / 180
+	lambda1 := lon * math.Pi / 180
+	theta := bearing * math.Pi / 180
+	delta := distance / earthRadius
+
+	phi2 := math.Asin(math.Sin(phi1)*math.Cos(delta) + math.Cos(phi1)*math.Sin(delta)*math.Cos(theta))
+	lambda2 := lambda1 + math.Atan2(math.Sin(theta)*math.Sin(delta)*math.Cos(phi1), math.Cos(delta)-math.Sin(phi1)*math.Sin(phi2))
+
+	return phi2 * 180 / math.Pi, math.Mod(lambda2*180/math.Pi+540, 360) - 180
+}
+
+/*
+initialBearing calculates bearing (degrees, 0..360) from point 1 to point 2
+*/
+func initialBearing(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1 := lat1 * math.Pi / 180
+	phi2 := lat2 * math.Pi / 180
+	deltaLambda := (lon2 - lon1) * math.Pi / 180
+
+	y := math.Sin(deltaLambda) * math.Cos(phi2)
+	x := math.Cos(phi1)*math.Sin(phi2) - math.Sin(phi1)*math.Cos(phi2)*math.Cos(deltaLambda)
+
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360)
+}
@@ -0,0 +1,171 @@
+/*
+Purpose:
+- ID mapping between source nodes and new (derived) nodes
+
+Description:
+- Records one entry per new node: derived ID, source ID, network type (e.g. node_bicycle), source key
+  (e.g. rcn_ref) and ref (e.g. 53).
+- New nodes of known source nodes (same source ID, network type and source key) get the recorded ID
+  again, so IDs stay stable across runs and ID schemes.
+- Entries of source nodes not found in the current run are kept.
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package process
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/paulmach/osm"
+)
+
+// nodeSource defines the source of a new node
+type nodeSource struct {
+	ID        osm.NodeID // source node ID
+	Slot      int        // ID slot of source key
+	Network   string     // network type (e.g. "node_bicycle")
+	SourceKey string     // e.g. "rcn_ref"
+	Ref       string     // e.g. "53"
+}
+
+// idMappingKey identifies a new node
+type idMappingKey struct {
+	SourceID  osm.NodeID
+	Network   string
+	SourceKey string
+}
+
+// idMappingEntry defines the recorded ID of a new node
+type idMappingEntry struct {
+	DerivedID osm.NodeID
+	Ref       string
+	Used      bool // source node found in current run (ID reused or recorded)
+}
+
+// IDMapping holds the recorded IDs of new nodes
+type IDMapping struct {
+	entries map[idMappingKey]*idMappingEntry
+	ids     map[osm.NodeID]bool // all recorded derived IDs
+	Reused  int                 // IDs reused in current run
+}
+
+// IDMappingHeader defines the header of ID mapping records
+var IDMappingHeader = []string{"derived_id", "source_id", "network", "source_key", "ref"}
+
+/*
+NewIDMapping creates new (empty) ID mapping
+*/
+func NewIDMapping() *IDMapping {
+	return &IDMapping{
+		entries: make(map[idMappingKey]*idMappingEntry),
+		ids:     make(map[osm.NodeID]bool),
+	}
+}
+
+/*
+Load adds ID mapping records (first record may be the header)
+*/
+func (m *IDMapping) Load(records [][]string) error {
+	for i, record := range records {
+		if i == 0 && len(record) > 0 && record[0] == IDMappingHeader[0] {
+			continue
+		}
+		if len(record) != len(IDMappingHeader) {
+			return fmt.Errorf("line %d: %d fields, %d expected", i+1, len(record), len(IDMappingHeader))
+		}
+		derivedID, err := strconv.ParseInt(record[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("line %d: invalid derived ID '%s'", i+1, record[0])
+		}
+		sourceID, err := strconv.ParseInt(record[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("line %d: invalid source ID '%s'", i+1, record[1])
+		}
+		if m.ids[osm.NodeID(derivedID)] {
+			return fmt.Errorf("line %d: duplicate derived ID %d", i+1, derivedID)
+		}
+		key := idMappingKey{SourceID: osm.NodeID(sourceID), Network: record[2], SourceKey: record[3]}
+		m.entries[key] = &idMappingEntry{DerivedID: osm.NodeID(derivedID), Ref: record[4]}
+		m.ids[osm.NodeID(derivedID)] = true
+	}
+	return nil
+}
+
+/*
+Len returns number of entries
+*/
+func (m *IDMapping) Len() int {
+	return len(m.entries)
+}
+
+/*
+Unused returns number of entries whose source node was not found in current run (kept)
+*/
+func (m *IDMapping) Unused() int {
+	unused := 0
+	for _, entry := range m.entries {
+		if !entry.Used {
+			unused++
+		}
+	}
+	return unused
+}
+
+/*
+Records returns ID mapping records including header (sorted by derived ID)
+*/
+func (m *IDMapping) Records() [][]string {
+	keys := make([]idMappingKey, 0, len(m.entries))
+	for key := range m.entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return m.entries[keys[i]].DerivedID < m.entries[keys[j]].DerivedID })
+
+	records := [][]string{IDMappingHeader}
+	for _, key := range keys {
+		entry := m.entries[key]
+		records = append(records, []string{
+			strconv.FormatInt(int64(entry.DerivedID), 10),
+			strconv.FormatInt(int64(key.SourceID), 10),
+			key.Network,
+			key.SourceKey,
+			entry.Ref,
+		})
+	}
+	return records
+}
+
+/*
+lookup returns recorded ID of new node (false = not recorded)
+*/
+func (m *IDMapping) lookup(source nodeSource) (osm.NodeID, bool) {
+	entry, found := m.entries[idMappingKey{SourceID: source.ID, Network: source.Network, SourceKey: source.SourceKey}]
+	if !found {
+		return 0, false
+	}
+	entry.Used = true
+	entry.Ref = source.Ref
+	m.Reused++
+	return entry.DerivedID, true
+}
+
+/*
+record records ID of new node
+*/
+func (m *IDMapping) record(source nodeSource, id osm.NodeID) error {
+	if m.ids[id] {
+		return fmt.Errorf("new node ID %d (source node %d, %s) already recorded for another source node", id, source.ID, source.SourceKey)
+	}
+	key := idMappingKey{SourceID: source.ID, Network: source.Network, SourceKey: source.SourceKey}
+	m.entries[key] = &idMappingEntry{DerivedID: id, Ref: source.Ref, Used: true}
+	m.ids[id] = true
+	return nil
+}
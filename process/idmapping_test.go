@@ -0,0 +1,107 @@
+/*
+Purpose:
+- Tests of persistent ID mapping
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package process
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/paulmach/osm"
+)
+
+/*
+TestIDMappingLoad checks loading of records (with and without header) and invalid records
+*/
+func TestIDMappingLoad(t *testing.T) {
+	records := [][]string{
+		IDMappingHeader,
+		{"1000", "355939532", "node_bicycle", "rcn_ref", "53"},
+		{"1001", "355939532", "node_hiking", "rwn_ref", "X32"},
+	}
+	m := NewIDMapping()
+	err := m.Load(records)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if m.Len() != 2 {
+		t.Errorf("Len = %d, expected 2", m.Len())
+	}
+	if got := m.Records(); !reflect.DeepEqual(got, records) {
+		t.Errorf("Records = %v, expected %v", got, records)
+	}
+
+	// without header
+	m = NewIDMapping()
+	if err := m.Load(records[1:]); err != nil || m.Len() != 2 {
+		t.Errorf("Load without header: %v, %d entries", err, m.Len())
+	}
+
+	invalid := map[string][][]string{
+		"field count":       {{"1000", "1", "node_bicycle", "rcn_ref"}},
+		"derived ID":        {{"x", "1", "node_bicycle", "rcn_ref", "53"}},
+		"source ID":         {{"1000", "x", "node_bicycle", "rcn_ref", "53"}},
+		"duplicate derived": {{"1000", "1", "node_bicycle", "rcn_ref", "53"}, {"1000", "2", "node_bicycle", "rcn_ref", "54"}},
+	}
+	for name, records := range invalid {
+		if err := NewIDMapping().Load(records); err == nil {
+			t.Errorf("%s: error expected", name)
+		}
+	}
+}
+
+/*
+TestIDMappingReuse checks reuse of recorded IDs and recording of new IDs (sequential scheme skips recorded IDs)
+*/
+func TestIDMappingReuse(t *testing.T) {
+	m := NewIDMapping()
+	err := m.Load([][]string{
+		{"1000", "7", "node_bicycle", "rcn_ref", "53"},
+		{"1001", "8", "node_bicycle", "rcn_ref", "54"},
+	})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	ids, _ := NewNodeIDs(IDSchemeSequential, 1000, 1, 0, DefaultRuleSet())
+	ids.Mapping = m
+
+	// recorded source: recorded ID (ref updated)
+	id, err := ids.assign(nodeSource{ID: 8, Network: "node_bicycle", SourceKey: "rcn_ref", Ref: "55"})
+	if err != nil || id != 1001 {
+		t.Errorf("assign recorded = %d, %v, expected 1001", id, err)
+	}
+	// new source: next free ID (1000 and 1001 are recorded)
+	id, err = ids.assign(nodeSource{ID: 9, Network: "node_bicycle", SourceKey: "rcn_ref", Ref: "56"})
+	if err != nil || id != 1002 {
+		t.Errorf("assign new = %d, %v, expected 1002", id, err)
+	}
+	if m.Reused != 1 || m.Len() != 3 || m.Unused() != 1 {
+		t.Errorf("Reused = %d, Len = %d, Unused = %d, expected 1, 3 and 1", m.Reused, m.Len(), m.Unused())
+	}
+
+	expected := [][]string{
+		IDMappingHeader,
+		{"1000", "7", "node_bicycle", "rcn_ref", "53"},
+		{"1001", "8", "node_bicycle", "rcn_ref", "55"},
+		{"1002", "9", "node_bicycle", "rcn_ref", "56"},
+	}
+	if got := m.Records(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Records = %v, expected %v", got, expected)
+	}
+
+	// recording an ID of another source node fails
+	err = m.record(nodeSource{ID: 10, Network: "node_hiking", SourceKey: "rwn_ref"}, osm.NodeID(1000))
+	if err == nil {
+		t.Errorf("record of recorded ID: error expected")
+	}
+}
@@ -0,0 +1,33 @@
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+/*
+Purpose:
+- Memory-mapping of files (other platforms: not supported, files are accessed directly)
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package process
+
+import (
+	"os"
+)
+
+/*
+mapFile returns nil (memory-mapping not supported, file is accessed directly)
+*/
+func mapFile(file *os.File, size int64) ([]byte, error) {
+	return nil, nil
+}
+
+/*
+unmapFile does nothing (memory-mapping not supported)
+*/
+func unmapFile(data []byte) error {
+	return nil
+}
@@ -0,0 +1,34 @@
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+/*
+Purpose:
+- Memory-mapping of files (unix platforms)
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package process
+
+import (
+	"os"
+	"syscall"
+)
+
+/*
+mapFile maps file content (size bytes) into memory (shared, writes go to file)
+*/
+func mapFile(file *os.File, size int64) ([]byte, error) {
+	return syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+}
+
+/*
+unmapFile unmaps file content
+*/
+func unmapFile(data []byte) error {
+	return syscall.Munmap(data)
+}
@@ -0,0 +1,132 @@
+/*
+Purpose:
+- IDs of new nodes
+
+Description:
+- ID scheme 'sequential': new node IDs are assigned in order of creation (start, start+1, ...). The
+  same junction gets another ID if the input data changes.
+- ID scheme 'source': new node ID = start + sourceID * slots + slot (negative: -1 - (sourceID * slots
+  + slot)). Each source key of the node_network rules (e.g. rcn_ref of the bicycle rule) has its own
+  slot (position in the rules, counted over all rules). The same junction always gets the same ID, as
+  long as start, slots and the order of the source keys in the rules are unchanged.
+- Collision guarantees of ID scheme 'source': different (source node, source key) pairs always get
+  different IDs (slot < slots, no overflow as long as start + maxSourceID * slots < 2^63). New IDs
+  don't collide with input node IDs if start is above the maximum input node ID (e.g. startNode=auto
+  or negative). Adding source keys requires more slots: reserve slots (option idSlots) to keep IDs
+  stable when rules are extended.
+- IDs recorded in the ID mapping are reused (and skipped by the sequential scheme).
+- CheckCollision checks the IDs of all new nodes against the node ID range of the input data.
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package process
+
+import (
+	"fmt"
+
+	"github.com/paulmach/osm"
+)
+
+// ID schemes for new nodes
+const (
+	IDSchemeSequential = "sequential"
+	IDSchemeSource     = "source"
+)
+
+// NodeIDs assigns the IDs of new nodes (shared by all runs, e.g. several input files)
+type NodeIDs struct {
+	Scheme  string
+	Start   osm.NodeID // first ID (offset)
+	Step    osm.NodeID // step between IDs (1 = ascending, -1 = descending negative IDs)
+	Slots   int        // slots per source node (ID scheme 'source')
+	Mapping *IDMapping // recorded IDs (nil = no ID mapping)
+
+	Written int     // new nodes written
+	Range   IDRange // IDs of new nodes written
+
+	next osm.NodeID // next ID (ID scheme 'sequential')
+}
+
+/*
+NewNodeIDs creates new node ID assignment (slots = 0: number of source keys in rules)
+*/
+func NewNodeIDs(scheme string, start, step osm.NodeID, slots int, rs *RuleSet) (*NodeIDs, error) {
+	ids := &NodeIDs{Scheme: scheme, Start: start, Step: step, Range: *newIDRange(), next: start}
+
+	switch scheme {
+	case IDSchemeSequential:
+	case IDSchemeSource:
+		minSlots := rs.IDSlots()
+		if slots == 0 {
+			slots = minSlots
+		}
+		if slots < minSlots {
+			return nil, fmt.Errorf("%d slots too few for %d source keys in rules", slots, minSlots)
+		}
+		ids.Slots = slots
+	default:
+		return nil, fmt.Errorf("unsupported ID scheme '%s'", scheme)
+	}
+
+	return ids, nil
+}
+
+/*
+assign returns ID for new node (from ID mapping, derived from source or sequential)
+*/
+func (ids *NodeIDs) assign(source nodeSource) (osm.NodeID, error) {
+	if ids.Mapping != nil {
+		if id, found := ids.Mapping.lookup(source); found {
+			return ids.written(id), nil
+		}
+	}
+
+	var id osm.NodeID
+	if ids.Scheme == IDSchemeSource {
+		id = ids.Start + ids.Step*(source.ID*osm.NodeID(ids.Slots)+osm.NodeID(source.Slot))
+	} else {
+		// skip IDs recorded in ID mapping
+		for ids.Mapping != nil && ids.Mapping.ids[ids.next] {
+			ids.next += ids.Step
+		}
+		id = ids.next
+		ids.next += ids.Step
+	}
+
+	if ids.Mapping != nil {
+		err := ids.Mapping.record(source, id)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return ids.written(id), nil
+}
+
+/*
+written counts ID of new node
+*/
+func (ids *NodeIDs) written(id osm.NodeID) osm.NodeID {
+	ids.Written++
+	ids.Range.Add(int64(id))
+	return id
+}
+
+/*
+CheckCollision checks if range of new node IDs overlaps node ID range of input data
+*/
+func (ids *NodeIDs) CheckCollision(inputRange *IDRange) error {
+	newRange := ids.Range
+	if inputRange == nil || inputRange.Min > inputRange.Max || newRange.Min > newRange.Max {
+		return nil // no input nodes or no new nodes
+	}
+	if newRange.Max >= inputRange.Min && newRange.Min <= inputRange.Max {
+		return fmt.Errorf("new node IDs %d .. %d collide with input node ID range %d .. %d", newRange.Min, newRange.Max, inputRange.Min, inputRange.Max)
+	}
+	return nil
+}
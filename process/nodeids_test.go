@@ -0,0 +1,120 @@
+/*
+Purpose:
+- Tests of new node ID assignment
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package process
+
+import (
+	"testing"
+
+	"github.com/paulmach/osm"
+)
+
+/*
+TestNodeIDsSource checks ID scheme 'source' (derived from source node ID and slot)
+*/
+func TestNodeIDsSource(t *testing.T) {
+	rs := DefaultRuleSet()
+	slots := rs.IDSlots()
+
+	ids, err := NewNodeIDs(IDSchemeSource, 1000000000000, 1, 0, rs)
+	if err != nil {
+		t.Fatalf("NewNodeIDs: %v", err)
+	}
+	if ids.Slots != slots {
+		t.Errorf("Slots = %d, expected %d (source keys in rules)", ids.Slots, slots)
+	}
+
+	seen := make(map[osm.NodeID]bool)
+	for _, sourceID := range []osm.NodeID{1, 2, 355939532} {
+		for slot := 0; slot < slots; slot++ {
+			id, err := ids.assign(nodeSource{ID: sourceID, Slot: slot})
+			if err != nil {
+				t.Fatalf("assign: %v", err)
+			}
+			expected := 1000000000000 + sourceID*osm.NodeID(slots) + osm.NodeID(slot)
+			if id != expected {
+				t.Errorf("assign(%d, slot %d) = %d, expected %d", sourceID, slot, id, expected)
+			}
+			if seen[id] {
+				t.Errorf("assign(%d, slot %d): ID %d assigned twice", sourceID, slot, id)
+			}
+			seen[id] = true
+		}
+	}
+	if ids.Written != len(seen) {
+		t.Errorf("Written = %d, expected %d", ids.Written, len(seen))
+	}
+
+	// same source, same ID (stable across runs)
+	again, _ := NewNodeIDs(IDSchemeSource, 1000000000000, 1, 0, rs)
+	if id, _ := again.assign(nodeSource{ID: 2, Slot: 1}); id != 1000000000000+2*osm.NodeID(slots)+1 {
+		t.Errorf("assign not stable: %d", id)
+	}
+
+	// negative IDs
+	negative, _ := NewNodeIDs(IDSchemeSource, -1, -1, 0, rs)
+	if id, _ := negative.assign(nodeSource{ID: 3, Slot: 0}); id != -1-3*osm.NodeID(slots) {
+		t.Errorf("negative assign = %d, expected %d", id, -1-3*osm.NodeID(slots))
+	}
+}
+
+/*
+TestNewNodeIDsErrors checks invalid schemes and slot numbers
+*/
+func TestNewNodeIDsErrors(t *testing.T) {
+	rs := DefaultRuleSet()
+	if _, err := NewNodeIDs("random", 1, 1, 0, rs); err == nil {
+		t.Errorf("unknown scheme: error expected")
+	}
+	if _, err := NewNodeIDs(IDSchemeSource, 1, 1, rs.IDSlots()-1, rs); err == nil {
+		t.Errorf("too few slots: error expected")
+	}
+	ids, err := NewNodeIDs(IDSchemeSource, 1, 1, rs.IDSlots()+5, rs)
+	if err != nil || ids.Slots != rs.IDSlots()+5 {
+		t.Errorf("more slots: %v, slots %d", err, ids.Slots)
+	}
+}
+
+/*
+TestCheckCollision checks overlap of new node IDs and input node IDs
+*/
+func TestCheckCollision(t *testing.T) {
+	rs := DefaultRuleSet()
+	tests := []struct {
+		start, step osm.NodeID
+		count       int
+		input       *IDRange
+		collision   bool
+	}{
+		{1000, 1, 3, &IDRange{Min: 1, Max: 999}, false},     // below new IDs
+		{1000, 1, 3, &IDRange{Min: 1003, Max: 2000}, false}, // above new IDs
+		{1000, 1, 3, &IDRange{Min: 1, Max: 1000}, true},     // first new ID
+		{1000, 1, 3, &IDRange{Min: 1002, Max: 5000}, true},  // last new ID
+		{-1, -1, 3, &IDRange{Min: 1, Max: 5000}, false},     // negative new IDs
+		{-1, -1, 3, &IDRange{Min: -2, Max: 5000}, true},     // negative input IDs
+		{1000, 1, 0, &IDRange{Min: 1, Max: 5000}, false},    // no new nodes
+		{1000, 1, 3, newIDRange(), false},                   // no input nodes
+		{1000, 1, 3, nil, false},                            // no input range
+	}
+	for i, test := range tests {
+		ids, _ := NewNodeIDs(IDSchemeSequential, test.start, test.step, 0, rs)
+		for n := 0; n < test.count; n++ {
+			if _, err := ids.assign(nodeSource{ID: osm.NodeID(n)}); err != nil {
+				t.Fatalf("assign: %v", err)
+			}
+		}
+		err := ids.CheckCollision(test.input)
+		if (err != nil) != test.collision {
+			t.Errorf("test %d: CheckCollision = %v, collision expected: %v", i, err, test.collision)
+		}
+	}
+}
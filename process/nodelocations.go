@@ -0,0 +1,200 @@
+/*
+Purpose:
+- Node location lookup
+
+Description:
+- Stores coordinates of nodes for later use with way members (e.g. bearing of way segments).
+- Coordinates are stored as fixed point values (1e-7 degrees, same precision as OSM).
+- Backends:
+  - map: in-memory map (small inputs)
+  - sparse: in-memory sparse array (blocks of node IDs, allocated when used)
+  - dense: memory-mapped file indexed by node ID (planet-scale inputs, RAM is used as cache)
+  - sorted: on-disk file of nodes sorted by ID (planet-scale inputs, requires input sorted by node ID)
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package process
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+
+	"github.com/paulmach/osm"
+)
+
+// node location store backends
+const (
+	LocationStoreMap    = "map"
+	LocationStoreSparse = "sparse"
+	LocationStoreDense  = "dense"
+	LocationStoreSorted = "sorted"
+)
+
+// NodeLocationStore defines a node location lookup
+type NodeLocationStore interface {
+	Set(id osm.NodeID, lat, lon float64) error
+	Get(id osm.NodeID) (lat, lon float64, found bool)
+	Close() error // releases resources (e.g. removes temporary file), returns deferred errors
+}
+
+/*
+NewNodeLocationStore creates node location store (filename: file of dense and sorted backend, "" = temporary file)
+*/
+func NewNodeLocationStore(backend, filename string) (NodeLocationStore, error) {
+	switch backend {
+	case LocationStoreMap, "":
+		return NewMapNodeLocationStore(), nil
+	case LocationStoreSparse:
+		return NewSparseNodeLocationStore(), nil
+	case LocationStoreDense:
+		return NewDenseNodeLocationStore(filename)
+	case LocationStoreSorted:
+		return NewSortedNodeLocationStore(filename)
+	}
+	return nil, fmt.Errorf("unsupported node location store '%s'", backend)
+}
+
+/*
+checkLocationStore checks name of node location store backend
+*/
+func checkLocationStore(backend string) error {
+	if backend == "" {
+		return nil
+	}
+	for _, name := range LocationStoreNames() {
+		if name == backend {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported node location store '%s'", backend)
+}
+
+/*
+LocationStoreNames returns names of all node location store backends
+*/
+func LocationStoreNames() []string {
+	return []string{LocationStoreMap, LocationStoreSparse, LocationStoreDense, LocationStoreSorted}
+}
+
+// nodeLocation defines node coordinates as fixed point values
+type nodeLocation struct {
+	Lat, Lon int32
+}
+
+// MapNodeLocationStore stores node locations in memory (map)
+type MapNodeLocationStore struct {
+	locations map[osm.NodeID]nodeLocation
+}
+
+/*
+NewMapNodeLocationStore creates new in-memory node location store
+*/
+func NewMapNodeLocationStore() *MapNodeLocationStore {
+	return &MapNodeLocationStore{locations: make(map[osm.NodeID]nodeLocation)}
+}
+
+/*
+Set stores node location
+*/
+func (s *MapNodeLocationStore) Set(id osm.NodeID, lat, lon float64) error {
+	s.locations[id] = newNodeLocation(lat, lon)
+	return nil
+}
+
+/*
+Get returns node location
+*/
+func (s *MapNodeLocationStore) Get(id osm.NodeID) (float64, float64, bool) {
+	location, found := s.locations[id]
+	if !found {
+		return 0, 0, false
+	}
+	lat, lon := location.coordinates()
+	return lat, lon, true
+}
+
+/*
+Close releases node locations
+*/
+func (s *MapNodeLocationStore) Close() error {
+	s.locations = nil
+	return nil
+}
+
+/*
+newNodeLocation converts coordinates to fixed point values
+*/
+func newNodeLocation(lat, lon float64) nodeLocation {
+	return nodeLocation{Lat: int32(math.Round(lat * 1e7)), Lon: int32(math.Round(lon * 1e7))}
+}
+
+/*
+coordinates converts fixed point values to coordinates
+*/
+func (l nodeLocation) coordinates() (float64, float64) {
+	return float64(l.Lat) / 1e7, float64(l.Lon) / 1e7
+}
+
+/*
+packed returns location as array element (0 = not set, the sign bit of lat is flipped, only the
+invalid latitude math.MinInt32 would result in 0)
+*/
+func (l nodeLocation) packed() uint64 {
+	return uint64(uint32(l.Lat)^0x80000000)<<32 | uint64(uint32(l.Lon))
+}
+
+/*
+unpackNodeLocation returns location of array element
+*/
+func unpackNodeLocation(value uint64) (nodeLocation, bool) {
+	if value == 0 {
+		return nodeLocation{}, false
+	}
+	return nodeLocation{Lat: int32(uint32(value>>32) ^ 0x80000000), Lon: int32(uint32(value))}, true
+}
+
+// locationFile is the file of a disk-backed node location store
+type locationFile struct {
+	file      *os.File
+	temporary bool // remove file on close
+}
+
+/*
+createLocationFile creates file of disk-backed node location store ("" = temporary file)
+*/
+func createLocationFile(filename string) (*locationFile, error) {
+	if filename == "" {
+		file, err := ioutil.TempFile("", "osmpp-locations-")
+		if err != nil {
+			return nil, fmt.Errorf("could not create temporary node location file: %v", err)
+		}
+		return &locationFile{file: file, temporary: true}, nil
+	}
+
+	file, err := os.OpenFile(filename, os.O_RDWR|os.O_TRUNC|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("could not create node location file: %v", err)
+	}
+	return &locationFile{file: file}, nil
+}
+
+/*
+close closes (and removes temporary) file
+*/
+func (f *locationFile) close() error {
+	err := f.file.Close()
+	if f.temporary {
+		if removeErr := os.Remove(f.file.Name()); err == nil {
+			err = removeErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,169 @@
+/*
+Purpose:
+- Node location lookup (dense memory-mapped file)
+
+Description:
+- The file is indexed by node ID (8 bytes per node ID, from 0 to the highest node ID). It is created
+  as sparse file and grows with the highest node ID. The file is memory-mapped, so the operating
+  system keeps the used parts in RAM (page cache) and the rest on disk.
+- Suitable for planet-scale inputs. Negative node IDs (e.g. new objects in editor files) are stored
+  in a map.
+- Platforms without memory-mapping (see mmap_*.go) read and write the file directly.
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package process
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/paulmach/osm"
+)
+
+// minimum growth of dense node location file (node IDs)
+const denseMinGrowth = 1 << 24
+
+// DenseNodeLocationStore stores node locations in a memory-mapped file (indexed by node ID)
+type DenseNodeLocationStore struct {
+	file     *locationFile
+	data     []byte // memory-mapped file (nil = direct file access)
+	count    int64  // node IDs covered by file
+	negative map[osm.NodeID]nodeLocation
+	err      error // first read error (returned by Close)
+}
+
+/*
+NewDenseNodeLocationStore creates new dense node location store (filename "" = temporary file)
+*/
+func NewDenseNodeLocationStore(filename string) (*DenseNodeLocationStore, error) {
+	file, err := createLocationFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &DenseNodeLocationStore{file: file, negative: make(map[osm.NodeID]nodeLocation)}, nil
+}
+
+/*
+Set stores node location
+*/
+func (s *DenseNodeLocationStore) Set(id osm.NodeID, lat, lon float64) error {
+	if id < 0 {
+		s.negative[id] = newNodeLocation(lat, lon)
+		return nil
+	}
+	if int64(id) >= s.count {
+		err := s.grow(int64(id) + 1)
+		if err != nil {
+			return err
+		}
+	}
+
+	offset := int64(id) * 8
+	value := newNodeLocation(lat, lon).packed()
+	if s.data != nil {
+		binary.LittleEndian.PutUint64(s.data[offset:], value)
+		return nil
+	}
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], value)
+	_, err := s.file.file.WriteAt(buf[:], offset)
+	if err != nil {
+		return fmt.Errorf("could not write node location: %v", err)
+	}
+	return nil
+}
+
+/*
+Get returns node location
+*/
+func (s *DenseNodeLocationStore) Get(id osm.NodeID) (float64, float64, bool) {
+	if id < 0 {
+		location, found := s.negative[id]
+		if !found {
+			return 0, 0, false
+		}
+		lat, lon := location.coordinates()
+		return lat, lon, true
+	}
+	if int64(id) >= s.count {
+		return 0, 0, false
+	}
+
+	offset := int64(id) * 8
+	var value uint64
+	if s.data != nil {
+		value = binary.LittleEndian.Uint64(s.data[offset:])
+	} else {
+		var buf [8]byte
+		_, err := s.file.file.ReadAt(buf[:], offset)
+		if err != nil {
+			if s.err == nil {
+				s.err = fmt.Errorf("could not read node location: %v", err)
+			}
+			return 0, 0, false
+		}
+		value = binary.LittleEndian.Uint64(buf[:])
+	}
+
+	location, found := unpackNodeLocation(value)
+	if !found {
+		return 0, 0, false
+	}
+	lat, lon := location.coordinates()
+	return lat, lon, true
+}
+
+/*
+Close unmaps and closes (temporary file: removes) node location file
+*/
+func (s *DenseNodeLocationStore) Close() error {
+	err := s.err
+	if s.data != nil {
+		if unmapErr := unmapFile(s.data); err == nil {
+			err = unmapErr
+		}
+		s.data = nil
+	}
+	if closeErr := s.file.close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+/*
+grow enlarges (and remaps) node location file to cover at least count node IDs
+*/
+func (s *DenseNodeLocationStore) grow(count int64) error {
+	newCount := 2 * s.count
+	if newCount < count {
+		newCount = count
+	}
+	if newCount < s.count+denseMinGrowth {
+		newCount = s.count + denseMinGrowth
+	}
+
+	if s.data != nil {
+		err := unmapFile(s.data)
+		if err != nil {
+			return fmt.Errorf("could not unmap node location file: %v", err)
+		}
+		s.data = nil
+	}
+	err := s.file.file.Truncate(newCount * 8)
+	if err != nil {
+		return fmt.Errorf("could not resize node location file: %v", err)
+	}
+	s.data, err = mapFile(s.file.file, newCount*8)
+	if err != nil {
+		return fmt.Errorf("could not map node location file: %v", err)
+	}
+	s.count = newCount
+	return nil
+}
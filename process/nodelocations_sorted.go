@@ -0,0 +1,176 @@
+/*
+Purpose:
+- Node location lookup (sorted on-disk file)
+
+Description:
+- Nodes are appended to the file as records (node ID, lat, lon; 16 bytes), the node IDs must be
+  ascending (e.g. PBF files, sorted XML files). Only the first node ID of each block of 4096 records
+  is kept in memory, a lookup reads one block from disk.
+- Size of file grows with the number of nodes (not with the highest node ID as the dense store).
+- All nodes must be stored before the first lookup (OSM files: nodes precede ways).
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package process
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/paulmach/osm"
+)
+
+// record layout of sorted node location file
+const (
+	sortedRecordSize   = 16   // node ID (8 bytes), lat (4 bytes), lon (4 bytes)
+	sortedBlockRecords = 4096 // records per block (lookup unit)
+)
+
+// SortedNodeLocationStore stores node locations in an on-disk file sorted by node ID
+type SortedNodeLocationStore struct {
+	file   *locationFile
+	writer *bufio.Writer // nil = file is complete (after first lookup)
+	count  int64         // records written
+	lastID osm.NodeID    // last node ID written
+	index  []osm.NodeID  // first node ID of each block
+
+	block      []byte // block read last
+	blockIndex int    // index of block read last (-1 = none)
+	err        error  // first read error (returned by Close)
+}
+
+/*
+NewSortedNodeLocationStore creates new sorted node location store (filename "" = temporary file)
+*/
+func NewSortedNodeLocationStore(filename string) (*SortedNodeLocationStore, error) {
+	file, err := createLocationFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	s := &SortedNodeLocationStore{
+		file:       file,
+		writer:     bufio.NewWriterSize(file.file, sortedBlockRecords*sortedRecordSize),
+		blockIndex: -1,
+	}
+	return s, nil
+}
+
+/*
+Set appends node location (node IDs must be ascending)
+*/
+func (s *SortedNodeLocationStore) Set(id osm.NodeID, lat, lon float64) error {
+	if s.writer == nil {
+		return fmt.Errorf("node %d stored after first lookup (sorted node location store requires nodes before ways)", id)
+	}
+	if s.count > 0 && id <= s.lastID {
+		return fmt.Errorf("node IDs not sorted (%d after %d), sorted node location store requires input sorted by node ID", id, s.lastID)
+	}
+
+	if s.count%sortedBlockRecords == 0 {
+		s.index = append(s.index, id)
+	}
+	location := newNodeLocation(lat, lon)
+	var record [sortedRecordSize]byte
+	binary.LittleEndian.PutUint64(record[0:], uint64(id))
+	binary.LittleEndian.PutUint32(record[8:], uint32(location.Lat))
+	binary.LittleEndian.PutUint32(record[12:], uint32(location.Lon))
+	_, err := s.writer.Write(record[:])
+	if err != nil {
+		return fmt.Errorf("could not write node location: %v", err)
+	}
+	s.count++
+	s.lastID = id
+	return nil
+}
+
+/*
+Get returns node location (first lookup completes the file)
+*/
+func (s *SortedNodeLocationStore) Get(id osm.NodeID) (float64, float64, bool) {
+	if s.writer != nil {
+		err := s.writer.Flush()
+		s.writer = nil
+		if err != nil {
+			s.err = fmt.Errorf("could not flush node location file: %v", err)
+		}
+	}
+
+	// block containing node ID
+	blockIndex := sort.Search(len(s.index), func(i int) bool { return s.index[i] > id }) - 1
+	if blockIndex < 0 || !s.readBlock(blockIndex) {
+		return 0, 0, false
+	}
+
+	records := len(s.block) / sortedRecordSize
+	i := sort.Search(records, func(i int) bool { return s.recordID(i) >= id })
+	if i == records || s.recordID(i) != id {
+		return 0, 0, false
+	}
+	record := s.block[i*sortedRecordSize:]
+	location := nodeLocation{
+		Lat: int32(binary.LittleEndian.Uint32(record[8:])),
+		Lon: int32(binary.LittleEndian.Uint32(record[12:])),
+	}
+	lat, lon := location.coordinates()
+	return lat, lon, true
+}
+
+/*
+Close closes (temporary file: removes) node location file
+*/
+func (s *SortedNodeLocationStore) Close() error {
+	err := s.err
+	if s.writer != nil {
+		if flushErr := s.writer.Flush(); err == nil {
+			err = flushErr
+		}
+		s.writer = nil
+	}
+	if closeErr := s.file.close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+/*
+readBlock reads block of records from file (unless already read)
+*/
+func (s *SortedNodeLocationStore) readBlock(blockIndex int) bool {
+	if blockIndex == s.blockIndex {
+		return true
+	}
+
+	records := s.count - int64(blockIndex)*sortedBlockRecords
+	if records > sortedBlockRecords {
+		records = sortedBlockRecords
+	}
+	if cap(s.block) < sortedBlockRecords*sortedRecordSize {
+		s.block = make([]byte, sortedBlockRecords*sortedRecordSize)
+	}
+	s.block = s.block[:records*sortedRecordSize]
+	_, err := s.file.file.ReadAt(s.block, int64(blockIndex)*sortedBlockRecords*sortedRecordSize)
+	if err != nil {
+		if s.err == nil {
+			s.err = fmt.Errorf("could not read node location file: %v", err)
+		}
+		s.blockIndex = -1
+		return false
+	}
+	s.blockIndex = blockIndex
+	return true
+}
+
+/*
+recordID returns node ID of record in block read last
+*/
+func (s *SortedNodeLocationStore) recordID(i int) osm.NodeID {
+	return osm.NodeID(binary.LittleEndian.Uint64(s.block[i*sortedRecordSize:]))
+}
@@ -0,0 +1,91 @@
+/*
+Purpose:
+- Node location lookup (in-memory sparse array)
+
+Description:
+- Node IDs are split into blocks of 65536 IDs, a block is allocated when the first node of the block
+  is stored (8 bytes per node ID of the block). Suitable for larger inputs with dense node IDs
+  (less memory per node than a map).
+- Negative node IDs (e.g. new objects in editor files) are stored in a map.
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package process
+
+import (
+	"github.com/paulmach/osm"
+)
+
+// node IDs per block of sparse array (2^sparseBlockBits)
+const sparseBlockBits = 16
+
+// sparseBlock holds the packed locations of one block of node IDs
+type sparseBlock [1 << sparseBlockBits]uint64
+
+// SparseNodeLocationStore stores node locations in memory (sparse array)
+type SparseNodeLocationStore struct {
+	blocks   []*sparseBlock
+	negative map[osm.NodeID]nodeLocation
+}
+
+/*
+NewSparseNodeLocationStore creates new in-memory sparse array node location store
+*/
+func NewSparseNodeLocationStore() *SparseNodeLocationStore {
+	return &SparseNodeLocationStore{negative: make(map[osm.NodeID]nodeLocation)}
+}
+
+/*
+Set stores node location
+*/
+func (s *SparseNodeLocationStore) Set(id osm.NodeID, lat, lon float64) error {
+	location := newNodeLocation(lat, lon)
+	if id < 0 {
+		s.negative[id] = location
+		return nil
+	}
+
+	index := int(id >> sparseBlockBits)
+	if index >= len(s.blocks) {
+		// append grows capacity geometrically (sorted input extends the array block by block)
+		s.blocks = append(s.blocks, make([]*sparseBlock, index+1-len(s.blocks))...)
+	}
+	if s.blocks[index] == nil {
+		s.blocks[index] = new(sparseBlock)
+	}
+	s.blocks[index][id&(1<<sparseBlockBits-1)] = location.packed()
+	return nil
+}
+
+/*
+Get returns node location
+*/
+func (s *SparseNodeLocationStore) Get(id osm.NodeID) (float64, float64, bool) {
+	var location nodeLocation
+	found := false
+	if id < 0 {
+		location, found = s.negative[id]
+	} else if index := int(id >> sparseBlockBits); index < len(s.blocks) && s.blocks[index] != nil {
+		location, found = unpackNodeLocation(s.blocks[index][id&(1<<sparseBlockBits-1)])
+	}
+	if !found {
+		return 0, 0, false
+	}
+	lat, lon := location.coordinates()
+	return lat, lon, true
+}
+
+/*
+Close releases node locations
+*/
+func (s *SparseNodeLocationStore) Close() error {
+	s.blocks = nil
+	s.negative = nil
+	return nil
+}
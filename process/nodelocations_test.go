@@ -0,0 +1,159 @@
+/*
+Purpose:
+- Tests of node location store backends
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package process
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/paulmach/osm"
+)
+
+// testLocation defines a node location for store tests
+type testLocation struct {
+	id       osm.NodeID
+	lat, lon float64
+}
+
+/*
+testLocations returns ascending node locations (negative IDs, several sorted blocks, large ID gap)
+*/
+func testLocations() []testLocation {
+	locations := []testLocation{
+		{-5, 52.1234567, 7.7654321},
+		{-1, -33.8688197, 151.2092955},
+		{0, 0, 0},
+	}
+	for i := 1; i <= 2*sortedBlockRecords+10; i++ {
+		locations = append(locations, testLocation{osm.NodeID(3 * i), float64(i%180) - 89.9999999, float64(i%360) - 179.9999999})
+	}
+	locations = append(locations,
+		testLocation{2*denseMinGrowth + 7, 90, 180},
+		testLocation{2*denseMinGrowth + 8, -90, -180},
+	)
+	return locations
+}
+
+/*
+TestNodeLocationStores checks set and get of all backends
+*/
+func TestNodeLocationStores(t *testing.T) {
+	locations := testLocations()
+	for _, backend := range LocationStoreNames() {
+		store, err := NewNodeLocationStore(backend, "")
+		if err != nil {
+			t.Fatalf("%s: NewNodeLocationStore: %v", backend, err)
+		}
+		for _, l := range locations {
+			if err := store.Set(l.id, l.lat, l.lon); err != nil {
+				t.Fatalf("%s: Set(%d): %v", backend, l.id, err)
+			}
+		}
+
+		for _, l := range locations {
+			lat, lon, found := store.Get(l.id)
+			if !found || math.Abs(lat-l.lat) > 1e-7 || math.Abs(lon-l.lon) > 1e-7 {
+				t.Errorf("%s: Get(%d) = %v, %v, %v, expected %v, %v", backend, l.id, lat, lon, found, l.lat, l.lon)
+			}
+		}
+		for _, id := range []osm.NodeID{-3, 1, 2, 3*sortedBlockRecords + 1, 2*denseMinGrowth + 6, 1 << 40} {
+			if _, _, found := store.Get(id); found {
+				t.Errorf("%s: Get(%d): unexpected location", backend, id)
+			}
+		}
+
+		if err := store.Close(); err != nil {
+			t.Errorf("%s: Close: %v", backend, err)
+		}
+	}
+}
+
+/*
+TestNodeLocationFile checks named and temporary files of disk-backed stores
+*/
+func TestNodeLocationFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osmpp-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, backend := range []string{LocationStoreDense, LocationStoreSorted} {
+		filename := filepath.Join(dir, backend+".bin")
+		store, err := NewNodeLocationStore(backend, filename)
+		if err != nil {
+			t.Fatalf("%s: NewNodeLocationStore: %v", backend, err)
+		}
+		_ = store.Set(42, 52.5, 7.5)
+		if _, _, found := store.Get(42); !found {
+			t.Errorf("%s: Get(42): location expected", backend)
+		}
+		if err := store.Close(); err != nil {
+			t.Errorf("%s: Close: %v", backend, err)
+		}
+		if _, err := os.Stat(filename); err != nil {
+			t.Errorf("%s: named file removed: %v", backend, err)
+		}
+	}
+
+	// temporary file is removed
+	store, err := NewDenseNodeLocationStore("")
+	if err != nil {
+		t.Fatalf("NewDenseNodeLocationStore: %v", err)
+	}
+	temporary := store.file.file.Name()
+	_ = store.Close()
+	if _, err := os.Stat(temporary); !os.IsNotExist(err) {
+		t.Errorf("temporary file %s not removed", temporary)
+	}
+}
+
+/*
+TestSortedNodeLocationStoreOrder checks the errors of the sorted store (unsorted input, set after lookup)
+*/
+func TestSortedNodeLocationStoreOrder(t *testing.T) {
+	store, err := NewSortedNodeLocationStore("")
+	if err != nil {
+		t.Fatalf("NewSortedNodeLocationStore: %v", err)
+	}
+	defer store.Close()
+
+	if err := store.Set(10, 1, 1); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := store.Set(10, 1, 1); err == nil {
+		t.Errorf("Set of same ID: error expected")
+	}
+	if err := store.Set(5, 1, 1); err == nil {
+		t.Errorf("Set of lower ID: error expected")
+	}
+	store.Get(10)
+	if err := store.Set(20, 1, 1); err == nil {
+		t.Errorf("Set after Get: error expected")
+	}
+}
+
+/*
+TestNewNodeLocationStoreUnknown checks unknown backend
+*/
+func TestNewNodeLocationStoreUnknown(t *testing.T) {
+	if _, err := NewNodeLocationStore("btree", ""); err == nil {
+		t.Errorf("unknown backend: error expected")
+	}
+	if err := checkLocationStore("btree"); err == nil {
+		t.Errorf("checkLocationStore: error expected")
+	}
+}
@@ -0,0 +1,339 @@
+/*
+Purpose:
+- Processing step 'node_network'
+
+Description:
+- Junction nodes (network:type=node_network) are duplicated as new nodes (one per network type,
+  e.g. node_bicycle, node_hiking) with new IDs (as defined in the node_network rules).
+- Optionally detects junctions without network:type tag through route relation membership
+  (option RelationJunctions) and validates expected_*_route_relations tags (option RouteRelationQA).
+- Multi-pass relation junctions: relations (route members), ways (nodes of member ways), all objects
+  (junctions are confirmed when read, no candidates are kept in memory).
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package process
+
+import (
+	"fmt"
+
+	"github.com/paulmach/osm"
+)
+
+// nodeNetworkStep holds the state of processing step 'node_network'
+type nodeNetworkStep struct {
+	ctx               *StepContext
+	relationJunctions *relationJunctions       // nil = disabled (or multi-pass)
+	membership        *routeMembership         // multi-pass relation junctions (nil = disabled)
+	validation        *routeRelationValidation // nil = disabled
+	pass              int                      // current pass
+
+	pointsFound         int
+	relationPointsFound int
+	displaced           int
+	written             int
+	levels              map[string]int // new nodes per network level
+	mismatches          []RouteRelationMismatch
+}
+
+/*
+newNodeNetworkStep creates processing step 'node_network'
+*/
+func newNodeNetworkStep(ctx *StepContext) Step {
+	s := &nodeNetworkStep{ctx: ctx, levels: make(map[string]int)}
+	if ctx.Options.RelationJunctions && ctx.Options.MultiPass {
+		s.membership = newRouteMembership(ctx.Rules)
+	}
+	if ctx.Options.RelationJunctions && s.membership == nil {
+		s.relationJunctions = newRelationJunctions(ctx.Rules)
+	}
+	if ctx.Options.RouteRelationQA {
+		s.validation = newRouteRelationValidation()
+	}
+	return s
+}
+
+/*
+Node creates new node_network objects for junction node
+*/
+func (s *nodeNetworkStep) Node(node *osm.Node) error {
+	if len(node.Tags) == 0 {
+		return nil
+	}
+	tags := node.TagMap()
+
+	tagValue, found := tags["network:type"]
+	if found && tagValue == "node_network" {
+		s.pointsFound++
+		err := s.createNewNodeNetworkObject(node)
+		if err != nil {
+			return err
+		}
+	} else if s.relationJunctions != nil {
+		// junction without network:type tag (confirmed by route relation membership)
+		s.relationJunctions.registerCandidate(node, tags)
+	} else if s.membership != nil && s.membership.confirmed(node, tags) {
+		s.relationPointsFound++
+		err := s.createNewNodeNetworkObject(node)
+		if err != nil {
+			return err
+		}
+	}
+
+	// register junction nodes for route relation validation
+	if s.validation != nil {
+		s.validation.registerNode(node, tags)
+	}
+
+	return nil
+}
+
+/*
+Way remembers junction nodes which are part of way
+*/
+func (s *nodeNetworkStep) Way(way *osm.Way) error {
+	if s.membership != nil && s.pass == 1 {
+		s.membership.addWay(way)
+		return nil
+	}
+	if s.validation != nil {
+		s.validation.registerWay(way)
+	}
+	if s.relationJunctions != nil {
+		s.relationJunctions.registerWay(way)
+	}
+	return nil
+}
+
+/*
+Relation counts route relation for junction nodes
+*/
+func (s *nodeNetworkStep) Relation(relation *osm.Relation) error {
+	if s.membership != nil && s.pass == 0 {
+		s.membership.addRelation(relation, relation.TagMap())
+		return nil
+	}
+	if s.validation == nil && s.relationJunctions == nil {
+		return nil
+	}
+
+	tags := relation.TagMap()
+	if s.validation != nil {
+		s.validation.countRelation(relation, tags)
+	}
+	if s.relationJunctions != nil {
+		s.relationJunctions.confirm(relation, tags)
+	}
+	return nil
+}
+
+/*
+Passes returns passes of step (multi-pass relation junctions: relations, ways, all objects)
+*/
+func (s *nodeNetworkStep) Passes() []Pass {
+	if s.membership != nil {
+		return []Pass{PassRelations, PassWays, PassAll}
+	}
+	return []Pass{PassAll}
+}
+
+/*
+EndPass prepares next pass
+*/
+func (s *nodeNetworkStep) EndPass(pass int) error {
+	if s.membership != nil && pass == 1 {
+		s.membership.ways = nil // node membership is complete
+	}
+	s.pass = pass + 1
+	return nil
+}
+
+/*
+Finish creates new node_network objects for junctions found through route relation membership
+*/
+func (s *nodeNetworkStep) Finish() error {
+	if s.relationJunctions != nil {
+		for _, node := range s.relationJunctions.confirmedNodes() {
+			s.relationPointsFound++
+			err := s.createNewNodeNetworkObject(node)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if s.validation != nil {
+		s.mismatches = s.validation.mismatches()
+	}
+
+	return nil
+}
+
+/*
+Stats adds junction point, route relation and new node statistics to result
+*/
+func (s *nodeNetworkStep) Stats(result *Result) {
+	result.Junctions = JunctionStats{
+		PointsFound:         s.pointsFound,
+		NodesDisplaced:      s.displaced,
+		RelationPointsFound: s.relationPointsFound,
+		Levels:              s.levels,
+	}
+	if s.relationJunctions != nil {
+		result.Junctions.RelationCandidates = len(s.relationJunctions.candidates)
+	}
+	if s.membership != nil {
+		result.Junctions.RelationCandidates = s.membership.candidates
+	}
+
+	if s.validation != nil {
+		result.RouteRelationMismatches = s.mismatches
+		result.RouteRelations = &RouteRelationStats{
+			JunctionsChecked: len(s.validation.checks),
+			Mismatches:       len(s.mismatches),
+		}
+	}
+
+	result.NewNodes.Written += s.written
+}
+
+/*
+createNewNodeNetworkObject creates new node_network objects (as defined in the node_network rules)
+<node id="355939532" lat="52.2220383" lon="7.022982600000001" user="" uid="0" visible="true" version="8" changeset="0" timestamp="2019-09-13T06:50:45Z">
+  <tag k="expected_rcn_route_relations" v="3"></tag>
+  <tag k="network:type" v="node_network"></tag>
+  <tag k="rcn:name" v="Spechtholtshook"></tag>
+  <tag k="rcn_ref" v="53"></tag>
+  <tag k="rwn_ref" v="X32"></tag>
+</node>
+... will be transformed to:
+<node id="xxxxxxx001" lat="52.2220383" lon="7.022982600000001" user="" uid="0" visible="true" version="8" changeset="0" timestamp="2019-09-13T06:50:45Z">
+  <tag k="node_network" v="node_bicycle"></tag>
+  <tag k="name" v="53"></tag>
+</node>
+<node id="xxxxxxx002" lat="52.2220383" lon="7.022982600000001" user="" uid="0" visible="true" version="8" changeset="0" timestamp="2019-09-13T06:50:45Z">
+  <tag k="node_network" v="node_hiking"></tag>
+  <tag k="name" v="X32"></tag>
+</node>
+... with option AllLevels each matching source key of a rule creates a new node (tagged with level).
+... with option JunctionNames each new node additionally gets its ref and, if the matching *:name tag
+exists (e.g. rcn:name for rcn_ref), its junction name, first node:
+  <tag k="node_network:ref" v="53"></tag>
+  <tag k="node_network:name" v="Spechtholtshook"></tag>
+... second node (no rwn:name tag):
+  <tag k="node_network:ref" v="X32"></tag>
+... with option DisplaceDistance both nodes are moved apart and get the original position:
+  <tag k="node_network:position" v="52.2220383,7.0229826"></tag>
+*/
+func (s *nodeNetworkStep) createNewNodeNetworkObject(sourceOsmNode *osm.Node) error {
+	rules := s.ctx.Rules
+	tags := sourceOsmNode.TagMap()
+	newOsmNodes := []osm.Node{}
+	sources := []nodeSource{}
+	levels := []string{}
+
+	for ruleIndex, rule := range rules.NodeNetworks {
+		// default: first matching source key wins (e.g. icn_ref before ncn_ref before rcn_ref before lcn_ref)
+		// all levels: each matching source key creates a new node
+		for keyIndex, sourceKey := range rule.SourceKeys {
+			refValue, found := tags[sourceKey]
+			if !found {
+				continue
+			}
+
+			nameValue := refValue
+			if rule.NameSource != NameSourceRef {
+				nameValue = tags[rule.NameSource]
+			}
+
+			level, found := rule.Levels[sourceKey]
+			if !found {
+				level = "unknown"
+			}
+
+			newOsmNode := *sourceOsmNode // copy content (don't modify origin/source node)
+			newOsmNode.ID = 0
+			newOsmNode.Tags = []osm.Tag{} // remove all source tags
+			tag := osm.Tag{Key: rule.OutputKey, Value: rule.OutputValue}
+			newOsmNode.Tags = append(newOsmNode.Tags, tag)
+			if nameValue != "" {
+				tag = osm.Tag{Key: rule.NameKey, Value: nameValue}
+				newOsmNode.Tags = append(newOsmNode.Tags, tag)
+			}
+			if s.ctx.Options.AllLevels {
+				tag = osm.Tag{Key: rules.LevelKey, Value: level}
+				newOsmNode.Tags = append(newOsmNode.Tags, tag)
+			}
+			if s.ctx.Options.JunctionNames {
+				// e.g. "node_network:ref=53" + "node_network:name=Spechtholtshook"
+				tag = osm.Tag{Key: rules.JunctionRefKey, Value: refValue}
+				newOsmNode.Tags = append(newOsmNode.Tags, tag)
+				junctionName := tags[rule.junctionNameKey(sourceKey)]
+				if junctionName != "" {
+					tag = osm.Tag{Key: rules.JunctionNameKey, Value: junctionName}
+					newOsmNode.Tags = append(newOsmNode.Tags, tag)
+				}
+			}
+			newOsmNodes = append(newOsmNodes, newOsmNode)
+			sources = append(sources, nodeSource{ID: sourceOsmNode.ID, Slot: rules.idSlot(ruleIndex, keyIndex),
+				Network: rule.OutputValue, SourceKey: sourceKey, Ref: refValue})
+			levels = append(levels, level)
+
+			if !s.ctx.Options.AllLevels {
+				break
+			}
+		}
+	}
+
+	// spread co-located nodes (e.g. node_bicycle + node_hiking) to avoid overlapping labels
+	displaced := s.ctx.Options.DisplaceDistance > 0 && len(newOsmNodes) > 1
+	if displaced {
+		original := fmt.Sprintf("%.7f,%.7f", sourceOsmNode.Lat, sourceOsmNode.Lon)
+		for i := range newOsmNodes {
+			bearing := s.ctx.Options.DisplaceBearings[i%len(s.ctx.Options.DisplaceBearings)]
+			newOsmNodes[i].Lat, newOsmNodes[i].Lon = destinationPoint(sourceOsmNode.Lat, sourceOsmNode.Lon, s.ctx.Options.DisplaceDistance, bearing)
+			tag := osm.Tag{Key: rules.OriginalPositionKey, Value: original}
+			newOsmNodes[i].Tags = append(newOsmNodes[i].Tags, tag)
+		}
+	}
+
+	for i := range newOsmNodes {
+		if !s.ctx.KeepNewNode(sourceOsmNode) {
+			continue
+		}
+		if displaced {
+			s.displaced++ // nodes written only (not clipped or skipped as duplicates)
+		}
+		s.levels[levels[i]]++
+		err := s.writeNewNodeObject(&newOsmNodes[i], sources[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+writeNewNodeObject writes new node object (ID from ID mapping, derived from source or sequential)
+*/
+func (s *nodeNetworkStep) writeNewNodeObject(newOsmNode *osm.Node, source nodeSource) error {
+	id, err := s.ctx.NodeIDs.assign(source)
+	if err != nil {
+		return fmt.Errorf("error in ID mapping: %v", err)
+	}
+	newOsmNode.ID = id
+	s.written++
+
+	err = s.ctx.Writer.WriteNewNode(newOsmNode)
+	if err != nil {
+		return fmt.Errorf("error writing new node: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+/*
+Purpose:
+- Tests of processing step 'node_network'
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package process
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/paulmach/osm"
+)
+
+/*
+TestNodeNetworkStep checks new nodes and per-level counts of one junction node
+*/
+func TestNodeNetworkStep(t *testing.T) {
+	unknownLevel := DefaultRuleSet()
+	delete(unknownLevel.NodeNetworks[0].Levels, "lcn_ref")
+
+	tests := []struct {
+		name     string
+		opts     Options
+		tags     []string   // tags of junction node (key, value, ...)
+		newNodes []osm.Tags // tags of new nodes (in order of creation)
+		levels   map[string]int
+	}{
+		{"no junction", Options{}, []string{"rcn_ref", "53"},
+			[]osm.Tags{}, map[string]int{}},
+		{"first match", Options{}, []string{"network:type", "node_network", "lcn_ref", "7", "rcn_ref", "53"},
+			[]osm.Tags{
+				{{Key: "node_network", Value: "node_bicycle"}, {Key: "name", Value: "53"}},
+			},
+			map[string]int{"regional": 1}},
+		{"first match per network", Options{}, []string{"network:type", "node_network", "rcn_ref", "53", "rwn_ref", "X32"},
+			[]osm.Tags{
+				{{Key: "node_network", Value: "node_bicycle"}, {Key: "name", Value: "53"}},
+				{{Key: "node_network", Value: "node_hiking"}, {Key: "name", Value: "X32"}},
+			},
+			map[string]int{"regional": 2}},
+		{"all levels", Options{AllLevels: true}, []string{"network:type", "node_network", "lcn_ref", "7", "rcn_ref", "53"},
+			[]osm.Tags{
+				{{Key: "node_network", Value: "node_bicycle"}, {Key: "name", Value: "53"}, {Key: "node_network:level", Value: "regional"}},
+				{{Key: "node_network", Value: "node_bicycle"}, {Key: "name", Value: "7"}, {Key: "node_network:level", Value: "local"}},
+			},
+			map[string]int{"regional": 1, "local": 1}},
+		{"all levels, all networks", Options{AllLevels: true}, []string{"network:type", "node_network", "icn_ref", "1", "ncn_ref", "2", "lwn_ref", "3"},
+			[]osm.Tags{
+				{{Key: "node_network", Value: "node_bicycle"}, {Key: "name", Value: "1"}, {Key: "node_network:level", Value: "international"}},
+				{{Key: "node_network", Value: "node_bicycle"}, {Key: "name", Value: "2"}, {Key: "node_network:level", Value: "national"}},
+				{{Key: "node_network", Value: "node_hiking"}, {Key: "name", Value: "3"}, {Key: "node_network:level", Value: "local"}},
+			},
+			map[string]int{"international": 1, "national": 1, "local": 1}},
+		{"all levels, level not in rule", Options{Rules: unknownLevel, AllLevels: true}, []string{"network:type", "node_network", "lcn_ref", "7"},
+			[]osm.Tags{
+				{{Key: "node_network", Value: "node_bicycle"}, {Key: "name", Value: "7"}, {Key: "node_network:level", Value: "unknown"}},
+			},
+			map[string]int{"unknown": 1}},
+		{"junction names", Options{JunctionNames: true}, []string{"network:type", "node_network", "rcn_ref", "53", "rwn_ref", "X32", "rcn:name", "Spechtholtshook"},
+			[]osm.Tags{
+				{{Key: "node_network", Value: "node_bicycle"}, {Key: "name", Value: "53"}, {Key: "node_network:ref", Value: "53"}, {Key: "node_network:name", Value: "Spechtholtshook"}},
+				{{Key: "node_network", Value: "node_hiking"}, {Key: "name", Value: "X32"}, {Key: "node_network:ref", Value: "X32"}},
+			},
+			map[string]int{"regional": 2}},
+		{"junction names, each network", Options{JunctionNames: true}, []string{"network:type", "node_network", "rcn_ref", "53", "rwn_ref", "X32", "rwn:name", "Hoher Berg"},
+			[]osm.Tags{
+				{{Key: "node_network", Value: "node_bicycle"}, {Key: "name", Value: "53"}, {Key: "node_network:ref", Value: "53"}},
+				{{Key: "node_network", Value: "node_hiking"}, {Key: "name", Value: "X32"}, {Key: "node_network:ref", Value: "X32"}, {Key: "node_network:name", Value: "Hoher Berg"}},
+			},
+			map[string]int{"regional": 2}},
+	}
+
+	for _, test := range tests {
+		opts := test.opts
+		opts.Processors = []string{StepNodeNetwork}
+		objects := func() []osm.Object {
+			return []osm.Object{testNode(1, 52.0, 7.0, test.tags...)}
+		}
+		result, collector := runTestProcessor(t, opts, objects)
+
+		tags := []osm.Tags{}
+		for i, node := range collector.newNodes {
+			tags = append(tags, node.Tags)
+			if node.ID != osm.NodeID(i+1) || node.Lat != 52.0 || node.Lon != 7.0 {
+				t.Errorf("%s: new node %d at %v,%v, expected %d at 52,7", test.name, node.ID, node.Lat, node.Lon, i+1)
+			}
+		}
+		if !reflect.DeepEqual(tags, test.newNodes) {
+			t.Errorf("%s: new nodes %v, expected %v", test.name, tags, test.newNodes)
+		}
+		if !reflect.DeepEqual(result.Junctions.Levels, test.levels) {
+			t.Errorf("%s: levels %v, expected %v", test.name, result.Junctions.Levels, test.levels)
+		}
+		if result.NewNodes.Written != len(test.newNodes) {
+			t.Errorf("%s: %d new nodes written, expected %d", test.name, result.NewNodes.Written, len(test.newNodes))
+		}
+	}
+}
+
+/*
+TestNodeNetworkDisplaceCounts counts displaced nodes only if written (not clipped, not skipped as duplicates)
+*/
+func TestNodeNetworkDisplaceCounts(t *testing.T) {
+	objects := func() []osm.Object {
+		return []osm.Object{testNode(1, 52.0, 7.0, "network:type", "node_network", "rcn_ref", "53", "rwn_ref", "X32")}
+	}
+
+	tests := []struct {
+		name      string
+		clip      Area
+		displaced int
+		clipAfter int
+	}{
+		{"no clipping", nil, 2, 0},
+		{"inside clip area", BBox{MinLon: 6.9, MinLat: 51.9, MaxLon: 7.1, MaxLat: 52.1}, 2, 2},
+		{"outside clip area", BBox{MinLon: 8.0, MinLat: 51.9, MaxLon: 8.1, MaxLat: 52.1}, 0, 0},
+	}
+
+	for _, test := range tests {
+		opts := Options{Processors: []string{StepNodeNetwork}, DisplaceDistance: 10, Clip: test.clip}
+		result, collector := runTestProcessor(t, opts, objects)
+		if result.Junctions.NodesDisplaced != test.displaced || len(collector.newNodes) != test.displaced {
+			t.Errorf("%s: %d nodes displaced, %d written, expected %d", test.name, result.Junctions.NodesDisplaced, len(collector.newNodes), test.displaced)
+		}
+		if test.clip != nil && (result.Clip.NewNodesBefore != 2 || result.Clip.NewNodesAfter != test.clipAfter) {
+			t.Errorf("%s: clip counts %d/%d, expected 2/%d", test.name, result.Clip.NewNodesBefore, result.Clip.NewNodesAfter, test.clipAfter)
+		}
+	}
+
+	// second input with the same junction (de-duplication)
+	processor, err := NewProcessor(Options{Processors: []string{StepNodeNetwork}, DisplaceDistance: 10, Deduplicate: true})
+	if err != nil {
+		t.Fatalf("NewProcessor: %v", err)
+	}
+	for run, expected := range []int{2, 0} {
+		result, err := processor.Run(newSliceScanner(objects()), &nodeCollector{})
+		if err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+		if result.Junctions.NodesDisplaced != expected {
+			t.Errorf("de-duplication run %d: %d nodes displaced, expected %d", run+1, result.Junctions.NodesDisplaced, expected)
+		}
+	}
+}
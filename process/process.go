@@ -0,0 +1,357 @@
+/*
+Purpose:
+- OSM data pre-processing (library package of osmpp)
+
+Description:
+- Processes node_network and turning_circle objects of one OSM data stream.
+- The work is done by the selected processing steps (see steps.go), the processor reads the objects,
+  passes them to all steps and collects the OSM data statistics.
+- node_network: junction nodes (network:type=node_network) are duplicated as new nodes (one per
+  network type, e.g. node_bicycle, node_hiking) with new IDs.
+- point_enrichment: point objects (e.g. turning_circle/loop) get the class of the way they sit on and
+  are written as modified nodes (with unmodified ID).
+- Derived nodes already written in an earlier run (overlapping inputs) can be skipped (see duplicates.go).
+- Derived nodes (new and modified nodes) can be clipped to a bounding box or polygon (see clip.go).
+- The caller provides the OSM data (osm.Scanner) and the output (NodeWriter) and gets the statistics
+  (Result). Reading files and writing output formats is left to the caller.
+
+Example:
+  ids, _ := process.NewNodeIDs(process.IDSchemeSequential, 1000000000000, 1, 0, rules)
+  p, _ := process.NewProcessor(process.Options{Rules: rules, NodeIDs: ids})
+  result, err := p.Run(scanner, writer)
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package process
+
+import (
+	"fmt"
+
+	"github.com/paulmach/osm"
+)
+
+// NodeWriter receives the nodes created or modified by the processor
+type NodeWriter interface {
+	WriteNewNode(node *osm.Node) error      // new node_network objects (in order of creation)
+	WriteModifiedNode(node *osm.Node) error // enriched point objects (sorted by ID)
+}
+
+// Options defines the processing options
+type Options struct {
+	Rules      *RuleSet // nil = built-in rules
+	NodeIDs    *NodeIDs // IDs of new nodes (nil = sequential, starting with 1)
+	Processors []string // processing steps in processing order (nil = all registered steps)
+
+	AllLevels         bool      // write one new node per network level (instead of first match only)
+	JunctionNames     bool      // carry junction name and ref onto new node_network objects
+	RelationJunctions bool      // detect junctions without network:type tag through route relation membership
+	DisplaceDistance  float64   // distance (meters) to spread co-located new nodes (0 = no displacement)
+	DisplaceBearings  []float64 // bearing pattern (degrees) for displacement (nil = DefaultDisplaceBearings)
+
+	PointAll       bool // record all way classes of point objects
+	PointDirection bool // add bearing of last way segment to dead-end point objects
+	PointPosition  bool // add position (end, middle, orphan) to point objects
+
+	RouteRelationQA bool // validate expected_*_route_relations tags (Result.RouteRelationMismatches)
+	PointQA         bool // collect mid-way and orphaned point objects (Result.PointIssues)
+
+	MultiPass bool // processing steps may read the input several times (requires RunPasses)
+	Clip      Area // derived nodes outside are dropped (nil = no clipping)
+
+	Deduplicate bool // skip derived nodes already written in an earlier run (overlapping inputs, combined output)
+
+	Locations     NodeLocationStore // node location lookup for point directions (nil = store created per run)
+	LocationStore string            // backend of store created per run (map, sparse, dense, sorted; "" = map)
+	LocationFile  string            // file of dense and sorted store ("" = temporary file)
+}
+
+// DefaultDisplaceBearings defines the default bearing pattern (degrees) for displacement
+var DefaultDisplaceBearings = []float64{0, 180, 90, 270, 45, 225, 135, 315}
+
+// Processor processes OSM data
+type Processor struct {
+	opts  Options
+	rules *RuleSet
+	ids   *NodeIDs
+
+	// state of current run
+	result    *Result
+	steps     []Step
+	locations NodeLocationStore
+	ownStore  bool // locations created by run (closed at end of run)
+	clip      *clipper
+	dups      *duplicates // shared by all runs (nil = no de-duplication)
+}
+
+/*
+NewProcessor creates new processor
+*/
+func NewProcessor(opts Options) (*Processor, error) {
+	p := &Processor{opts: opts, rules: opts.Rules, ids: opts.NodeIDs}
+	if p.rules == nil {
+		p.rules = DefaultRuleSet()
+	}
+	if p.ids == nil {
+		p.ids, _ = NewNodeIDs(IDSchemeSequential, 1, 1, 0, p.rules)
+	}
+	if p.opts.Deduplicate {
+		p.dups = newDuplicates()
+	}
+	if len(p.opts.DisplaceBearings) == 0 {
+		p.opts.DisplaceBearings = DefaultDisplaceBearings
+	}
+	if p.opts.Processors == nil {
+		p.opts.Processors = StepNames()
+	}
+	err := checkStepNames(p.opts.Processors)
+	if err != nil {
+		return nil, err
+	}
+	err = checkLocationStore(p.opts.LocationStore)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+/*
+Options returns the processing options (with defaults applied)
+*/
+func (p *Processor) Options() Options {
+	opts := p.opts
+	opts.Rules = p.rules
+	opts.NodeIDs = p.ids
+	return opts
+}
+
+/*
+Run processes all objects of scanner in one pass (new and modified nodes are written to writer, steps
+declaring several passes result in an error)
+*/
+func (p *Processor) Run(scanner osm.Scanner, writer NodeWriter) (*Result, error) {
+	if p.opts.MultiPass {
+		return nil, fmt.Errorf("multi-pass processing requires RunPasses")
+	}
+	open := func() (osm.Scanner, error) { return scanner, nil }
+	return p.run(open, writer, false)
+}
+
+/*
+RunPasses processes all objects in as many passes as the processing steps need (open is called once
+per pass, the scanners are closed after each pass). The same nodes as with Run are written, but relation
+junctions are created in input order (Run: after the last relation), so sequential IDs may differ.
+*/
+func (p *Processor) RunPasses(open OpenFunc, writer NodeWriter) (*Result, error) {
+	return p.run(open, writer, true)
+}
+
+/*
+run reads input once per pass and passes the objects to the processing steps (reopen = input is opened
+for each pass and the scanners are closed, otherwise one pass only)
+*/
+func (p *Processor) run(open OpenFunc, writer NodeWriter, reopen bool) (result *Result, err error) {
+	err = p.begin(writer)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		closeErr := p.end()
+		if err == nil && closeErr != nil {
+			result, err = nil, closeErr
+		}
+	}()
+
+	passes := make([][]Pass, len(p.steps))
+	readCount := 0
+	for i, step := range p.steps {
+		passes[i] = []Pass{PassAll}
+		if multiPassStep, ok := step.(MultiPassStep); ok {
+			passes[i] = multiPassStep.Passes()
+		}
+		if len(passes[i]) > readCount {
+			readCount = len(passes[i])
+		}
+		if !reopen && len(passes[i]) > 1 {
+			// Run: the scanner can't be read again
+			return nil, fmt.Errorf("processing step '%s' needs %d passes, use RunPasses", p.opts.Processors[i], len(passes[i]))
+		}
+	}
+
+	data := newOSMDataCollector()
+	for read := 0; read < readCount; read++ {
+		// objects needed in this read (all objects in first read for OSM data statistics)
+		needed := Pass{Nodes: true}
+		if read == 0 {
+			needed = PassAll
+		}
+		current := make([]Pass, len(p.steps))
+		for i := range p.steps {
+			if read < len(passes[i]) {
+				current[i] = passes[i][read]
+				needed.Ways = needed.Ways || current[i].Ways
+				needed.Relations = needed.Relations || current[i].Relations
+			}
+		}
+
+		scanner, err := open()
+		if err != nil {
+			return nil, fmt.Errorf("could not open input (pass %d): %v", read+1, err)
+		}
+		err = p.scan(scanner, current, needed, data, read == 0)
+		if reopen {
+			scanner.Close()
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for i, step := range p.steps {
+			if multiPassStep, ok := step.(MultiPassStep); ok && read < len(passes[i]) {
+				err = multiPassStep.EndPass(read)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	p.result.OSMData = data.stats()
+
+	for _, step := range p.steps {
+		err := step.Finish()
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, step := range p.steps {
+		step.Stats(p.result)
+	}
+	if p.clip != nil {
+		p.result.Clip = p.clip.result()
+	}
+	if p.dups != nil {
+		p.result.Duplicates = p.dups.end()
+	}
+
+	return p.result, nil
+}
+
+/*
+scan reads all objects of one pass (reading stops at first way or relation if only nodes are needed)
+*/
+func (p *Processor) scan(scanner osm.Scanner, passes []Pass, needed Pass, data *osmDataCollector, collect bool) error {
+	for scanner.Scan() {
+		object := scanner.Object()
+		if collect {
+			data.add(object)
+		}
+
+		switch e := object.(type) {
+		case *osm.Node:
+			if p.locations != nil && collect {
+				err := p.locations.Set(e.ID, e.Lat, e.Lon)
+				if err != nil {
+					return fmt.Errorf("could not store node location: %v", err)
+				}
+			}
+			for i, step := range p.steps {
+				if passes[i].Nodes {
+					err := step.Node(e)
+					if err != nil {
+						return err
+					}
+				}
+			}
+
+		case *osm.Way:
+			if !needed.Ways && !needed.Relations {
+				return nil // nodes precede ways and relations
+			}
+			for i, step := range p.steps {
+				if passes[i].Ways {
+					err := step.Way(e)
+					if err != nil {
+						return err
+					}
+				}
+			}
+
+		case *osm.Relation:
+			if !needed.Relations {
+				return nil // relations are the last objects
+			}
+			for i, step := range p.steps {
+				if passes[i].Relations {
+					err := step.Relation(e)
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("scanner returned error: %v", err)
+	}
+	return nil
+}
+
+/*
+begin initializes state of new run (new instances of all selected processing steps)
+*/
+func (p *Processor) begin(writer NodeWriter) error {
+	p.result = &Result{
+		Processors: p.opts.Processors,
+		Junctions:  JunctionStats{Levels: make(map[string]int)},
+		NewNodes:   NewNodeStats{StartID: int64(p.ids.Start)},
+		Points:     []PointStats{},
+	}
+
+	// multi-pass: point_enrichment collects the neighbouring way nodes in a separate pass
+	p.locations = nil
+	p.ownStore = false
+	if p.opts.PointDirection && !p.opts.MultiPass {
+		p.locations = p.opts.Locations
+		if p.locations == nil {
+			var err error
+			p.locations, err = NewNodeLocationStore(p.opts.LocationStore, p.opts.LocationFile)
+			if err != nil {
+				return err
+			}
+			p.ownStore = true
+		}
+	}
+
+	ctx := &StepContext{Options: p.Options(), Rules: p.rules, NodeIDs: p.ids, Writer: writer, Locations: p.locations,
+		clip: newClipper(p.opts.Clip), dups: p.dups}
+	if p.dups != nil {
+		p.dups.begin()
+	}
+	p.clip = ctx.clip
+	p.steps = []Step{}
+	for _, name := range p.opts.Processors {
+		p.steps = append(p.steps, findStep(name).newStep(ctx))
+	}
+	return nil
+}
+
+/*
+end releases state of run (closes node location store created by run)
+*/
+func (p *Processor) end() error {
+	if p.locations == nil || !p.ownStore {
+		return nil
+	}
+	err := p.locations.Close()
+	p.locations = nil
+	if err != nil {
+		return fmt.Errorf("error in node location store: %v", err)
+	}
+	return nil
+}
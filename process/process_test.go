@@ -0,0 +1,251 @@
+/*
+Purpose:
+- Tests of processor (single-pass and multi-pass)
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package process
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/paulmach/osm"
+)
+
+// sliceScanner reads OSM objects from memory
+type sliceScanner struct {
+	objects []osm.Object
+	next    int
+}
+
+/*
+newSliceScanner creates scanner of objects
+*/
+func newSliceScanner(objects []osm.Object) *sliceScanner {
+	return &sliceScanner{objects: objects}
+}
+
+/*
+Scan advances to next object
+*/
+func (s *sliceScanner) Scan() bool {
+	if s.next >= len(s.objects) {
+		return false
+	}
+	s.next++
+	return true
+}
+
+/*
+Object returns current object
+*/
+func (s *sliceScanner) Object() osm.Object {
+	return s.objects[s.next-1]
+}
+
+/*
+Err returns no error
+*/
+func (s *sliceScanner) Err() error {
+	return nil
+}
+
+/*
+Close does nothing
+*/
+func (s *sliceScanner) Close() error {
+	return nil
+}
+
+// nodeCollector collects new and modified nodes (copies)
+type nodeCollector struct {
+	newNodes      []*osm.Node
+	modifiedNodes []*osm.Node
+}
+
+/*
+WriteNewNode collects new node
+*/
+func (c *nodeCollector) WriteNewNode(node *osm.Node) error {
+	n := *node
+	n.Tags = append(osm.Tags{}, node.Tags...)
+	c.newNodes = append(c.newNodes, &n)
+	return nil
+}
+
+/*
+WriteModifiedNode collects modified node
+*/
+func (c *nodeCollector) WriteModifiedNode(node *osm.Node) error {
+	n := *node
+	n.Tags = append(osm.Tags{}, node.Tags...)
+	c.modifiedNodes = append(c.modifiedNodes, &n)
+	return nil
+}
+
+/*
+testNode creates node with tags (key, value, key, value, ...)
+*/
+func testNode(id osm.NodeID, lat, lon float64, tags ...string) *osm.Node {
+	node := &osm.Node{ID: id, Lat: lat, Lon: lon, Version: 1, Visible: true}
+	for i := 0; i+1 < len(tags); i += 2 {
+		node.Tags = append(node.Tags, osm.Tag{Key: tags[i], Value: tags[i+1]})
+	}
+	return node
+}
+
+/*
+testWay creates way with node IDs and tags (key, value, key, value, ...)
+*/
+func testWay(id osm.WayID, nodeIDs []osm.NodeID, tags ...string) *osm.Way {
+	way := &osm.Way{ID: id, Version: 1, Visible: true}
+	for _, nodeID := range nodeIDs {
+		way.Nodes = append(way.Nodes, osm.WayNode{ID: nodeID})
+	}
+	for i := 0; i+1 < len(tags); i += 2 {
+		way.Tags = append(way.Tags, osm.Tag{Key: tags[i], Value: tags[i+1]})
+	}
+	return way
+}
+
+/*
+testRouteRelation creates route relation of network with members
+*/
+func testRouteRelation(id osm.RelationID, network string, members ...osm.Member) *osm.Relation {
+	return &osm.Relation{ID: id, Version: 1, Visible: true, Members: members,
+		Tags: osm.Tags{{Key: "type", Value: "route"}, {Key: "network", Value: network}}}
+}
+
+/*
+multiPassObjects returns objects of test input (new objects on each call, steps modify the objects read)
+- node 1: junction without network:type tag (route relation member through way 100)
+- node 2: junction with network:type tag
+- node 3: junction without network:type tag (route relation member)
+- node 4: candidate without route relation
+- node 5: turning circle at dead end of way 101
+*/
+func multiPassObjects() []osm.Object {
+	return []osm.Object{
+		testNode(1, 52.001, 7.0, "rcn_ref", "12"),
+		testNode(2, 52.002, 7.0, "network:type", "node_network", "rcn_ref", "53", "rwn_ref", "X32", "rcn:name", "Spechtholtshook"),
+		testNode(3, 52.003, 7.0, "rwn_ref", "7"),
+		testNode(4, 52.004, 7.0, "rcn_ref", "99"),
+		testNode(5, 52.010, 7.010, "highway", "turning_circle"),
+		testNode(6, 52.011, 7.010),
+		testNode(7, 52.012, 7.011),
+		testWay(100, []osm.NodeID{1, 6}, "highway", "cycleway"),
+		testWay(101, []osm.NodeID{6, 5}, "highway", "service"),
+		testWay(102, []osm.NodeID{6, 7}, "highway", "residential"),
+		testRouteRelation(200, "rcn", osm.Member{Type: osm.TypeWay, Ref: 100}),
+		testRouteRelation(201, "rwn", osm.Member{Type: osm.TypeNode, Ref: 3}),
+	}
+}
+
+/*
+runTestProcessor processes test input in one pass or several passes
+*/
+func runTestProcessor(t *testing.T, opts Options, objects func() []osm.Object) (*Result, *nodeCollector) {
+	t.Helper()
+	processor, err := NewProcessor(opts)
+	if err != nil {
+		t.Fatalf("NewProcessor: %v", err)
+	}
+	collector := &nodeCollector{}
+	var result *Result
+	if opts.MultiPass {
+		open := func() (osm.Scanner, error) { return newSliceScanner(objects()), nil }
+		result, err = processor.RunPasses(open, collector)
+	} else {
+		result, err = processor.Run(newSliceScanner(objects()), collector)
+	}
+	if err != nil {
+		t.Fatalf("run (multi-pass %v): %v", opts.MultiPass, err)
+	}
+	return result, collector
+}
+
+/*
+nodeKeys returns descriptions of nodes (location and tags, with ID optionally), sorted
+*/
+func nodeKeys(nodes []*osm.Node, withID bool) []string {
+	keys := []string{}
+	for _, node := range nodes {
+		key := fmt.Sprintf("%.7f,%.7f %v", node.Lat, node.Lon, node.Tags)
+		if withID {
+			key = fmt.Sprintf("%d %s", node.ID, key)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+/*
+TestRunPassesMatchesRun processes the same input with Run and RunPasses (same new and modified nodes;
+sequential IDs of relation junctions differ as they are created in another order)
+*/
+func TestRunPassesMatchesRun(t *testing.T) {
+	for _, scheme := range []string{IDSchemeSequential, IDSchemeSource} {
+		results := []*Result{}
+		collectors := []*nodeCollector{}
+		for _, multiPass := range []bool{false, true} {
+			ids, err := NewNodeIDs(scheme, 1000, 1, 0, DefaultRuleSet())
+			if err != nil {
+				t.Fatalf("NewNodeIDs: %v", err)
+			}
+			opts := Options{NodeIDs: ids, MultiPass: multiPass, RelationJunctions: true, JunctionNames: true, AllLevels: true,
+				PointDirection: true, PointPosition: true}
+			result, collector := runTestProcessor(t, opts, multiPassObjects)
+			results = append(results, result)
+			collectors = append(collectors, collector)
+		}
+		single, multi := collectors[0], collectors[1]
+
+		if len(single.newNodes) != 4 {
+			t.Errorf("%s: %d new nodes, expected 4", scheme, len(single.newNodes))
+		}
+		if !reflect.DeepEqual(nodeKeys(single.newNodes, false), nodeKeys(multi.newNodes, false)) {
+			t.Errorf("%s: new nodes differ:\nsingle-pass %v\nmulti-pass  %v", scheme, nodeKeys(single.newNodes, false), nodeKeys(multi.newNodes, false))
+		}
+		// IDs derived from source are independent of the order of creation
+		if scheme == IDSchemeSource && !reflect.DeepEqual(nodeKeys(single.newNodes, true), nodeKeys(multi.newNodes, true)) {
+			t.Errorf("%s: new node IDs differ:\nsingle-pass %v\nmulti-pass  %v", scheme, nodeKeys(single.newNodes, true), nodeKeys(multi.newNodes, true))
+		}
+		if !reflect.DeepEqual(nodeKeys(single.modifiedNodes, true), nodeKeys(multi.modifiedNodes, true)) {
+			t.Errorf("%s: modified nodes differ:\nsingle-pass %v\nmulti-pass  %v", scheme, nodeKeys(single.modifiedNodes, true), nodeKeys(multi.modifiedNodes, true))
+		}
+
+		if !reflect.DeepEqual(results[0].Junctions, results[1].Junctions) {
+			t.Errorf("%s: junction statistics differ: %+v, %+v", scheme, results[0].Junctions, results[1].Junctions)
+		}
+		if !reflect.DeepEqual(results[0].Points, results[1].Points) {
+			t.Errorf("%s: point statistics differ: %+v, %+v", scheme, results[0].Points, results[1].Points)
+		}
+		if results[0].NewNodes.Written != results[1].NewNodes.Written || results[0].OSMData.Nodes != results[1].OSMData.Nodes {
+			t.Errorf("%s: statistics differ: %+v, %+v", scheme, results[0].NewNodes, results[1].NewNodes)
+		}
+	}
+}
+
+/*
+TestRunMultiPassStep rejects steps with several passes in Run
+*/
+func TestRunMultiPassStep(t *testing.T) {
+	processor, err := NewProcessor(Options{MultiPass: true, RelationJunctions: true})
+	if err != nil {
+		t.Fatalf("NewProcessor: %v", err)
+	}
+	_, err = processor.Run(newSliceScanner(multiPassObjects()), &nodeCollector{})
+	if err == nil {
+		t.Errorf("Run with option MultiPass: error expected")
+	}
+}
@@ -0,0 +1,291 @@
+/*
+Purpose:
+- Result of OSM data pre-processing
+
+Description:
+- Contains the statistics of one processing run (junction points, point objects, OSM data)
+  and the findings for the quality assurance files.
+- The JSON field names are part of the statistics report of osmpp (do not rename).
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package process
+
+import (
+	"math"
+	"time"
+
+	"github.com/paulmach/osm"
+)
+
+// Result defines the result of one processing run
+type Result struct {
+	Processors     []string            `json:"processors"` // processing steps run
+	Junctions      JunctionStats       `json:"junctions"`
+	RouteRelations *RouteRelationStats `json:"routeRelations,omitempty"` // only with route relation validation
+	NewNodes       NewNodeStats        `json:"newNodes"`
+	Points         []PointStats        `json:"points"`
+	OSMData        OSMDataStats        `json:"osmData"`
+	Clip           *ClipStats          `json:"clip,omitempty"`       // only with clip area
+	Duplicates     *DuplicateStats     `json:"duplicates,omitempty"` // only with de-duplication
+
+	RouteRelationMismatches []RouteRelationMismatch `json:"-"` // only with route relation validation
+	PointIssues             []PointIssue            `json:"-"` // only with point QA
+
+	runs int // number of runs added
+}
+
+// JunctionStats defines the junction point statistics
+type JunctionStats struct {
+	PointsFound         int            `json:"pointsFound"`
+	NodesDisplaced      int            `json:"nodesDisplaced"`
+	RelationCandidates  int            `json:"relationCandidates"`
+	RelationPointsFound int            `json:"relationPointsFound"`
+	Levels              map[string]int `json:"levels"` // new nodes per network level
+}
+
+// RouteRelationStats defines the route relation validation statistics
+type RouteRelationStats struct {
+	JunctionsChecked int `json:"junctionsChecked"`
+	Mismatches       int `json:"mismatches"`
+}
+
+// NewNodeStats defines the new nodes statistics
+type NewNodeStats struct {
+	Written int   `json:"written"`
+	StartID int64 `json:"startID"`
+}
+
+// PointStats defines the statistics of one point-on-way enrichment (e.g. turning circle/loop)
+type PointStats struct {
+	Name            string         `json:"name"`
+	OutputKey       string         `json:"outputKey"`
+	Found           map[string]int `json:"found"` // per node tag selector (e.g. "turning_circle")
+	Total           int            `json:"total"`
+	TypesAdded      int            `json:"typesAdded"`
+	TypesReplaced   int            `json:"typesReplaced"`
+	DirectionsAdded int            `json:"directionsAdded"`
+	Positions       map[string]int `json:"positions,omitempty"` // only with geometry (end, middle, orphan)
+	Classes         map[string]int `json:"classes"`             // per way class (e.g. "residential")
+}
+
+// OSMDataStats defines the OSM data statistics
+type OSMDataStats struct {
+	TimestampMin time.Time           `json:"timestampMin"`
+	TimestampMax time.Time           `json:"timestampMax"`
+	LonMin       float64             `json:"lonMin"`
+	LonMax       float64             `json:"lonMax"`
+	LatMin       float64             `json:"latMin"`
+	LatMax       float64             `json:"latMax"`
+	Nodes        int                 `json:"nodes"`
+	Ways         int                 `json:"ways"`
+	Relations    int                 `json:"relations"`
+	VersionMax   int                 `json:"versionMax"`
+	IDRanges     map[string]*IDRange `json:"idRanges"` // per object type (node, way, relation)
+
+	KeyvalPairsMax       int       `json:"keyvalPairsMax"`
+	KeyvalPairsMaxObject ObjectRef `json:"keyvalPairsMaxObject"`
+	NoderefsMax          int       `json:"noderefsMax"`
+	NoderefsMaxObject    ObjectRef `json:"noderefsMaxObject"`
+	RelrefsMax           int       `json:"relrefsMax"`
+	RelrefsMaxObject     ObjectRef `json:"relrefsMaxObject"`
+}
+
+// ClipStats defines the clipping statistics (derived nodes before and after clipping, extent of kept nodes)
+type ClipStats struct {
+	Area                string  `json:"area"`
+	NewNodesBefore      int     `json:"newNodesBefore"`
+	NewNodesAfter       int     `json:"newNodesAfter"`
+	ModifiedNodesBefore int     `json:"modifiedNodesBefore"`
+	ModifiedNodesAfter  int     `json:"modifiedNodesAfter"`
+	LonMin              float64 `json:"lonMin"`
+	LonMax              float64 `json:"lonMax"`
+	LatMin              float64 `json:"latMin"`
+	LatMax              float64 `json:"latMax"`
+}
+
+// DuplicateStats defines the derived nodes skipped because written in an earlier run
+type DuplicateStats struct {
+	NewNodes      int `json:"newNodes"`
+	ModifiedNodes int `json:"modifiedNodes"`
+}
+
+// IDRange defines min and max ID value
+type IDRange struct {
+	Min int64 `json:"min"`
+	Max int64 `json:"max"`
+}
+
+// ObjectRef defines a reference to an OSM object
+type ObjectRef struct {
+	Type string `json:"type"`
+	ID   int64  `json:"id"`
+}
+
+// PointIssue defines a mid-way or orphaned point object (e.g. turning_circle/loop node)
+type PointIssue struct {
+	NodeID   osm.NodeID
+	Lat, Lon float64
+	Object   string // matching node tag (e.g. "highway=turning_circle")
+	Position string // PositionMiddle or PositionOrphan
+}
+
+/*
+newIDRange creates new (empty) ID range
+*/
+func newIDRange() *IDRange {
+	return &IDRange{Min: math.MaxInt64, Max: math.MinInt64}
+}
+
+/*
+Add adds min or max ID
+*/
+func (r *IDRange) Add(ref int64) {
+	if ref > r.Max {
+		r.Max = ref
+	}
+	if ref < r.Min {
+		r.Min = ref
+	}
+}
+
+/*
+Add adds statistics of another run (e.g. of another input file) to result
+*/
+func (r *Result) Add(other *Result) {
+	r.Junctions.PointsFound += other.Junctions.PointsFound
+	r.Junctions.NodesDisplaced += other.Junctions.NodesDisplaced
+	r.Junctions.RelationCandidates += other.Junctions.RelationCandidates
+	r.Junctions.RelationPointsFound += other.Junctions.RelationPointsFound
+	r.Junctions.Levels = addCounts(r.Junctions.Levels, other.Junctions.Levels)
+
+	if other.RouteRelations != nil {
+		if r.RouteRelations == nil {
+			r.RouteRelations = &RouteRelationStats{}
+		}
+		r.RouteRelations.JunctionsChecked += other.RouteRelations.JunctionsChecked
+		r.RouteRelations.Mismatches += other.RouteRelations.Mismatches
+	}
+
+	if r.runs == 0 {
+		r.Processors = other.Processors
+		r.NewNodes.StartID = other.NewNodes.StartID
+	}
+	r.NewNodes.Written += other.NewNodes.Written
+
+	// all runs are processed with the same rules
+	for i, ps := range other.Points {
+		if i >= len(r.Points) {
+			r.Points = append(r.Points, PointStats{Name: ps.Name, OutputKey: ps.OutputKey})
+		}
+		total := &r.Points[i]
+		total.Found = addCounts(total.Found, ps.Found)
+		total.Total += ps.Total
+		total.TypesAdded += ps.TypesAdded
+		total.TypesReplaced += ps.TypesReplaced
+		total.DirectionsAdded += ps.DirectionsAdded
+		if ps.Positions != nil {
+			total.Positions = addCounts(total.Positions, ps.Positions)
+		}
+		total.Classes = addCounts(total.Classes, ps.Classes)
+	}
+
+	if other.Clip != nil {
+		if r.Clip == nil {
+			r.Clip = &ClipStats{Area: other.Clip.Area, LonMin: math.MaxFloat64, LonMax: -math.MaxFloat64,
+				LatMin: math.MaxFloat64, LatMax: -math.MaxFloat64}
+		}
+		r.Clip.add(other.Clip)
+	}
+
+	if other.Duplicates != nil {
+		if r.Duplicates == nil {
+			r.Duplicates = &DuplicateStats{}
+		}
+		r.Duplicates.NewNodes += other.Duplicates.NewNodes
+		r.Duplicates.ModifiedNodes += other.Duplicates.ModifiedNodes
+	}
+
+	r.OSMData.add(&other.OSMData, r.runs == 0)
+	r.runs++
+}
+
+/*
+add adds OSM data statistics of another run to total OSM data statistics
+*/
+func (d *OSMDataStats) add(other *OSMDataStats, first bool) {
+	if first {
+		*d = *other
+		d.IDRanges = make(map[string]*IDRange)
+		for objectType, r := range other.IDRanges {
+			d.IDRanges[objectType] = &IDRange{Min: r.Min, Max: r.Max}
+		}
+		return
+	}
+
+	if other.TimestampMin.Before(d.TimestampMin) {
+		d.TimestampMin = other.TimestampMin
+	}
+	if other.TimestampMax.After(d.TimestampMax) {
+		d.TimestampMax = other.TimestampMax
+	}
+	d.LonMin = math.Min(d.LonMin, other.LonMin)
+	d.LonMax = math.Max(d.LonMax, other.LonMax)
+	d.LatMin = math.Min(d.LatMin, other.LatMin)
+	d.LatMax = math.Max(d.LatMax, other.LatMax)
+	d.Nodes += other.Nodes
+	d.Ways += other.Ways
+	d.Relations += other.Relations
+	if other.VersionMax > d.VersionMax {
+		d.VersionMax = other.VersionMax
+	}
+	for objectType, r := range other.IDRanges {
+		d.IDRanges[objectType].Add(r.Min)
+		d.IDRanges[objectType].Add(r.Max)
+	}
+	if other.KeyvalPairsMax > d.KeyvalPairsMax {
+		d.KeyvalPairsMax = other.KeyvalPairsMax
+		d.KeyvalPairsMaxObject = other.KeyvalPairsMaxObject
+	}
+	if other.NoderefsMax > d.NoderefsMax {
+		d.NoderefsMax = other.NoderefsMax
+		d.NoderefsMaxObject = other.NoderefsMaxObject
+	}
+	if other.RelrefsMax > d.RelrefsMax {
+		d.RelrefsMax = other.RelrefsMax
+		d.RelrefsMaxObject = other.RelrefsMaxObject
+	}
+}
+
+/*
+add adds clipping statistics of another run to total clipping statistics
+*/
+func (c *ClipStats) add(other *ClipStats) {
+	c.NewNodesBefore += other.NewNodesBefore
+	c.NewNodesAfter += other.NewNodesAfter
+	c.ModifiedNodesBefore += other.ModifiedNodesBefore
+	c.ModifiedNodesAfter += other.ModifiedNodesAfter
+	c.LonMin = math.Min(c.LonMin, other.LonMin)
+	c.LonMax = math.Max(c.LonMax, other.LonMax)
+	c.LatMin = math.Min(c.LatMin, other.LatMin)
+	c.LatMax = math.Max(c.LatMax, other.LatMax)
+}
+
+/*
+addCounts adds counts to total counts
+*/
+func addCounts(total, counts map[string]int) map[string]int {
+	if total == nil {
+		total = make(map[string]int)
+	}
+	for key, count := range counts {
+		total[key] += count
+	}
+	return total
+}
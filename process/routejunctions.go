@@ -0,0 +1,226 @@
+/*
+Purpose:
+- Relation-aware detection of junction nodes
+
+Description:
+- Finds junction nodes without network:type=node_network tag through route relation membership.
+- Candidates are nodes with a ref tag from the node_network rules (e.g. rcn_ref). A candidate is
+  confirmed if the node itself or one of the member ways containing the node is member of a route
+  relation of the matching network (e.g. rcn_ref -> network=rcn).
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package process
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/paulmach/osm"
+)
+
+// relationJunctions holds the junction candidates and their route relation membership
+type relationJunctions struct {
+	rules      *RuleSet
+	candidates map[osm.NodeID]*osm.Node   // junction candidates
+	ways       map[osm.WayID][]osm.NodeID // junction candidates per way (only ways containing candidates)
+	confirmed  map[osm.NodeID]bool        // confirmed junction candidates
+}
+
+/*
+newRelationJunctions creates new relation-aware junction detection
+*/
+func newRelationJunctions(rs *RuleSet) *relationJunctions {
+	return &relationJunctions{
+		rules:      rs,
+		candidates: make(map[osm.NodeID]*osm.Node),
+		ways:       make(map[osm.WayID][]osm.NodeID),
+		confirmed:  make(map[osm.NodeID]bool),
+	}
+}
+
+/*
+registerCandidate stores node as candidate (if node has a node_network ref tag)
+*/
+func (rj *relationJunctions) registerCandidate(node *osm.Node, tags map[string]string) {
+	for key := range tags {
+		if rj.rules.isSourceKey(key) {
+			rj.candidates[node.ID] = node
+			return
+		}
+	}
+}
+
+/*
+registerWay remembers junction candidates which are part of way
+*/
+func (rj *relationJunctions) registerWay(way *osm.Way) {
+	for _, node := range way.Nodes {
+		if _, found := rj.candidates[node.ID]; found {
+			rj.ways[way.ID] = append(rj.ways[way.ID], node.ID)
+		}
+	}
+}
+
+/*
+confirm confirms all candidates contained in route relation of matching network
+*/
+func (rj *relationJunctions) confirm(relation *osm.Relation, tags map[string]string) {
+	if tags["type"] != "route" {
+		return
+	}
+	network := tags["network"]
+	if network == "" {
+		return
+	}
+	refKey := network + "_ref" // e.g. network=rcn -> rcn_ref
+
+	for _, member := range relation.Members {
+		var nodeIDs []osm.NodeID
+		switch member.Type {
+		case osm.TypeNode:
+			nodeIDs = []osm.NodeID{osm.NodeID(member.Ref)}
+		case osm.TypeWay:
+			nodeIDs = rj.ways[osm.WayID(member.Ref)]
+		}
+		for _, nodeID := range nodeIDs {
+			candidate, found := rj.candidates[nodeID]
+			if !found {
+				continue
+			}
+			if candidate.Tags.Find(refKey) != "" {
+				rj.confirmed[nodeID] = true
+			}
+		}
+	}
+}
+
+/*
+confirmedNodes returns all confirmed junction nodes (sorted by ID)
+*/
+func (rj *relationJunctions) confirmedNodes() []*osm.Node {
+	nodes := []*osm.Node{}
+	for nodeID := range rj.confirmed {
+		nodes = append(nodes, rj.candidates[nodeID])
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+
+	return nodes
+}
+
+/*
+isSourceKey checks if key is a source key of any node_network rule
+*/
+func (rs *RuleSet) isSourceKey(key string) bool {
+	if !strings.HasSuffix(key, "_ref") {
+		return false
+	}
+	for _, rule := range rs.NodeNetworks {
+		for _, sourceKey := range rule.SourceKeys {
+			if key == sourceKey {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// maximum number of source keys for multi-pass detection (one bit per source key)
+const maxMembershipSlots = 64
+
+// routeMembership holds the route relation membership of nodes (multi-pass detection: relations, ways, nodes)
+type routeMembership struct {
+	rules    *RuleSet
+	keyMasks map[string]uint64     // bit mask per source key (e.g. "rcn_ref")
+	ways     map[osm.WayID]uint64  // member ways of route relations (source keys of route networks)
+	nodes    map[osm.NodeID]uint64 // member nodes (directly or through member ways)
+
+	candidates int // junction candidates (nodes with source key, without network:type tag)
+}
+
+/*
+newRouteMembership creates new multi-pass relation junction detection (nil = too many source keys)
+*/
+func newRouteMembership(rs *RuleSet) *routeMembership {
+	if rs.IDSlots() > maxMembershipSlots {
+		return nil
+	}
+	m := &routeMembership{
+		rules:    rs,
+		keyMasks: make(map[string]uint64),
+		ways:     make(map[osm.WayID]uint64),
+		nodes:    make(map[osm.NodeID]uint64),
+	}
+	for ruleIndex, rule := range rs.NodeNetworks {
+		for keyIndex, sourceKey := range rule.SourceKeys {
+			m.keyMasks[sourceKey] |= 1 << uint(rs.idSlot(ruleIndex, keyIndex))
+		}
+	}
+	return m
+}
+
+/*
+addRelation remembers members of route relation (pass 1)
+*/
+func (m *routeMembership) addRelation(relation *osm.Relation, tags map[string]string) {
+	if tags["type"] != "route" {
+		return
+	}
+	mask := m.keyMasks[tags["network"]+"_ref"] // e.g. network=rcn -> rcn_ref
+	if mask == 0 {
+		return
+	}
+
+	for _, member := range relation.Members {
+		switch member.Type {
+		case osm.TypeNode:
+			m.nodes[osm.NodeID(member.Ref)] |= mask
+		case osm.TypeWay:
+			m.ways[osm.WayID(member.Ref)] |= mask
+		}
+	}
+}
+
+/*
+addWay passes route membership of way to its nodes (pass 2)
+*/
+func (m *routeMembership) addWay(way *osm.Way) {
+	mask, found := m.ways[way.ID]
+	if !found {
+		return
+	}
+	for _, node := range way.Nodes {
+		m.nodes[node.ID] |= mask
+	}
+}
+
+/*
+confirmed checks if junction candidate is member of a route relation of matching network (pass 3)
+*/
+func (m *routeMembership) confirmed(node *osm.Node, tags map[string]string) bool {
+	candidate := false
+	for key := range tags {
+		if m.rules.isSourceKey(key) {
+			candidate = true
+			break
+		}
+	}
+	if !candidate {
+		return false
+	}
+	m.candidates++
+
+	mask := m.nodes[node.ID]
+	for key, value := range tags {
+		if value != "" && mask&m.keyMasks[key] != 0 {
+			return true
+		}
+	}
+	return false
+}
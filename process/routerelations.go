@@ -0,0 +1,166 @@
+/*
+Purpose:
+- Route relation validation of junction nodes
+
+Description:
+- Validates expected_*_route_relations tags of junction nodes against actual route relation membership.
+- A junction node is counted as member of a route relation if the node itself or one of the member
+  ways containing the node is member of the relation.
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package process
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/paulmach/osm"
+)
+
+// junctionCheck holds expected and actual route relation counts of one junction node
+type junctionCheck struct {
+	ID       osm.NodeID
+	Lat, Lon float64
+	Expected map[string]int    // expected route relations per network (e.g. "rcn": 3)
+	Actual   map[string]int    // actual route relations per network
+	Refs     map[string]string // junction ref per network (e.g. "rcn": "53")
+}
+
+// routeRelationValidation holds the junction nodes to validate
+type routeRelationValidation struct {
+	checks map[osm.NodeID]*junctionCheck
+	ways   map[osm.WayID][]osm.NodeID // junction nodes per way (only ways containing junction nodes)
+}
+
+// RouteRelationMismatch defines one route relation mismatch
+type RouteRelationMismatch struct {
+	NodeID   osm.NodeID
+	Lat, Lon float64
+	Network  string // e.g. "rcn"
+	Ref      string // e.g. "53"
+	Expected int
+	Actual   int
+}
+
+/*
+newRouteRelationValidation creates new route relation validation
+*/
+func newRouteRelationValidation() *routeRelationValidation {
+	return &routeRelationValidation{
+		checks: make(map[osm.NodeID]*junctionCheck),
+		ways:   make(map[osm.WayID][]osm.NodeID),
+	}
+}
+
+/*
+registerNode registers node for route relation validation (if node has expected_*_route_relations tags)
+*/
+func (v *routeRelationValidation) registerNode(node *osm.Node, tags map[string]string) {
+	var check *junctionCheck
+
+	for key, value := range tags {
+		if !strings.HasPrefix(key, "expected_") || !strings.HasSuffix(key, "_route_relations") {
+			continue
+		}
+		network := strings.TrimSuffix(strings.TrimPrefix(key, "expected_"), "_route_relations")
+		expected, err := strconv.Atoi(value)
+		if err != nil || network == "" {
+			continue
+		}
+		if check == nil {
+			check = &junctionCheck{
+				ID:       node.ID,
+				Lat:      node.Lat,
+				Lon:      node.Lon,
+				Expected: make(map[string]int),
+				Actual:   make(map[string]int),
+				Refs:     make(map[string]string),
+			}
+		}
+		check.Expected[network] = expected
+		check.Refs[network] = tags[network+"_ref"]
+	}
+
+	if check != nil {
+		v.checks[node.ID] = check
+	}
+}
+
+/*
+registerWay remembers junction nodes which are part of way
+*/
+func (v *routeRelationValidation) registerWay(way *osm.Way) {
+	for _, node := range way.Nodes {
+		if _, found := v.checks[node.ID]; found {
+			v.ways[way.ID] = append(v.ways[way.ID], node.ID)
+		}
+	}
+}
+
+/*
+countRelation counts route relation for all junction nodes contained in relation
+*/
+func (v *routeRelationValidation) countRelation(relation *osm.Relation, tags map[string]string) {
+	if tags["type"] != "route" {
+		return
+	}
+	network := tags["network"]
+	if network == "" {
+		return
+	}
+
+	// collect junction nodes (each junction node counts once per relation)
+	contained := make(map[osm.NodeID]bool)
+	for _, member := range relation.Members {
+		switch member.Type {
+		case osm.TypeNode:
+			if _, found := v.checks[osm.NodeID(member.Ref)]; found {
+				contained[osm.NodeID(member.Ref)] = true
+			}
+		case osm.TypeWay:
+			for _, nodeID := range v.ways[osm.WayID(member.Ref)] {
+				contained[nodeID] = true
+			}
+		}
+	}
+
+	for nodeID := range contained {
+		check := v.checks[nodeID]
+		if _, found := check.Expected[network]; found {
+			check.Actual[network]++
+		}
+	}
+}
+
+/*
+mismatches returns all mismatches (sorted by node ID and network)
+*/
+func (v *routeRelationValidation) mismatches() []RouteRelationMismatch {
+	mismatches := []RouteRelationMismatch{}
+	for _, check := range v.checks {
+		for network, expected := range check.Expected {
+			actual := check.Actual[network]
+			if actual != expected {
+				mismatches = append(mismatches, RouteRelationMismatch{NodeID: check.ID, Lat: check.Lat, Lon: check.Lon,
+					Network: network, Ref: check.Refs[network], Expected: expected, Actual: actual})
+			}
+		}
+	}
+
+	sort.Slice(mismatches, func(i, j int) bool {
+		if mismatches[i].NodeID != mismatches[j].NodeID {
+			return mismatches[i].NodeID < mismatches[j].NodeID
+		}
+		return mismatches[i].Network < mismatches[j].Network
+	})
+
+	return mismatches
+}
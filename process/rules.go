@@ -0,0 +1,267 @@
+/*
+Purpose:
+- Rule set for OSM data pre-processing
+
+Description:
+- Defines the node_network rules (source keys, precedence, output tags).
+- Defines the point-on-way enrichment rules (node tags, way filter, output tag).
+- Rules are read from a JSON file. Without such a file the built-in default rule set is used.
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package process
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// RuleSet defines all rules used for pre-processing
+type RuleSet struct {
+	NodeNetworks []NodeNetworkRule `json:"nodeNetworks"`
+	LevelKey     string            `json:"levelKey"` // key of output level tag (e.g. "node_network:level")
+
+	JunctionNameKey string `json:"junctionNameKey"` // key of output junction name tag (e.g. "node_network:name")
+	JunctionRefKey  string `json:"junctionRefKey"`  // key of output junction ref tag (e.g. "node_network:ref")
+
+	OriginalPositionKey string `json:"originalPositionKey"` // key of original position tag of displaced nodes (e.g. "node_network:position")
+
+	PointEnrichments []PointEnrichmentRule `json:"pointEnrichments"`
+}
+
+// NodeNetworkRule defines how one output network type is derived from junction nodes
+type NodeNetworkRule struct {
+	Network     string   `json:"network"`     // descriptive network name (e.g. "bicycle")
+	SourceKeys  []string `json:"sourceKeys"`  // ref keys in order of precedence (first match wins)
+	OutputKey   string   `json:"outputKey"`   // key of output network tag (e.g. "node_network")
+	OutputValue string   `json:"outputValue"` // value of output network tag (e.g. "node_bicycle")
+	NameKey     string   `json:"nameKey"`     // key of output name tag (e.g. "name")
+	NameSource  string   `json:"nameSource"`  // "ref" = value of matching source key, otherwise key of source tag
+
+	Levels   map[string]string `json:"levels"`   // network level per source key (e.g. "rcn_ref": "regional")
+	NameTags map[string]string `json:"nameTags"` // junction name key per source key (default: "rcn_ref" -> "rcn:name")
+}
+
+// PointEnrichmentRule defines how point objects are enriched with the class of the way they sit on
+type PointEnrichmentRule struct {
+	Name      string        `json:"name"`      // descriptive name (e.g. "Turning circle/loop")
+	NodeTags  []TagSelector `json:"nodeTags"`  // node tags selecting the point objects (e.g. highway=turning_circle)
+	WayKey    string        `json:"wayKey"`    // key of way filter (e.g. "highway")
+	WayValues []string      `json:"wayValues"` // values of way filter (in order of priority)
+	OutputKey string        `json:"outputKey"` // key of output tag (e.g. "fzk_turning")
+}
+
+// TagSelector defines a tag (key and value) to select objects
+type TagSelector struct {
+	Key   string `json:"key"`
+	Value string `json:"value"` // empty = any value
+}
+
+// NameSourceRef refers to the value of the matching source key
+const NameSourceRef = "ref"
+
+// network levels (in hierarchical order)
+var NetworkLevels = []string{"international", "national", "regional", "local"}
+
+/*
+DefaultRuleSet returns the built-in rule set
+*/
+func DefaultRuleSet() *RuleSet {
+	return &RuleSet{
+		LevelKey:        "node_network:level",
+		JunctionNameKey: "node_network:name",
+		JunctionRefKey:  "node_network:ref",
+
+		OriginalPositionKey: "node_network:position",
+
+		PointEnrichments: []PointEnrichmentRule{
+			{Name: "Turning circle/loop", NodeTags: []TagSelector{{Key: "highway", Value: "turning_circle"}, {Key: "highway", Value: "turning_loop"}},
+				WayKey: "highway", WayValues: []string{"residential", "living_street", "unclassified", "service", "track"}, OutputKey: "fzk_turning"},
+		},
+		NodeNetworks: []NodeNetworkRule{
+			// Punktnetzwerk 'Fahrrad'
+			{Network: "bicycle", SourceKeys: []string{"icn_ref", "ncn_ref", "rcn_ref", "lcn_ref"},
+				OutputKey: "node_network", OutputValue: "node_bicycle", NameKey: "name", NameSource: NameSourceRef,
+				Levels: map[string]string{"icn_ref": "international", "ncn_ref": "national", "rcn_ref": "regional", "lcn_ref": "local"}},
+			// Punktnetzwerk 'Wandern'
+			{Network: "hiking", SourceKeys: []string{"iwn_ref", "nwn_ref", "rwn_ref", "lwn_ref"},
+				OutputKey: "node_network", OutputValue: "node_hiking", NameKey: "name", NameSource: NameSourceRef,
+				Levels: map[string]string{"iwn_ref": "international", "nwn_ref": "national", "rwn_ref": "regional", "lwn_ref": "local"}},
+			// Punktnetzwerk 'Inline-Skaten'
+			{Network: "inline_skates", SourceKeys: []string{"rin_ref"},
+				OutputKey: "node_network", OutputValue: "node_inline_skates", NameKey: "name", NameSource: NameSourceRef,
+				Levels: map[string]string{"rin_ref": "regional"}},
+			// Punktnetzwerk 'Reiten'
+			{Network: "horse", SourceKeys: []string{"rhn_ref"},
+				OutputKey: "node_network", OutputValue: "node_horse", NameKey: "name", NameSource: NameSourceRef,
+				Levels: map[string]string{"rhn_ref": "regional"}},
+			// Punktnetzwerk 'Kanu'
+			{Network: "canoe", SourceKeys: []string{"rpn_ref"},
+				OutputKey: "node_network", OutputValue: "node_canoe", NameKey: "name", NameSource: NameSourceRef,
+				Levels: map[string]string{"rpn_ref": "regional"}},
+			// Punktnetzwerk 'Motorboot'
+			{Network: "motorboat", SourceKeys: []string{"rmn_ref"},
+				OutputKey: "node_network", OutputValue: "node_motorboat", NameKey: "name", NameSource: NameSourceRef,
+				Levels: map[string]string{"rmn_ref": "regional"}},
+		},
+	}
+}
+
+/*
+junctionNameKey returns the key of the junction name tag for source key (e.g. "rcn_ref" -> "rcn:name")
+*/
+func (rule *NodeNetworkRule) junctionNameKey(sourceKey string) string {
+	if nameKey, found := rule.NameTags[sourceKey]; found {
+		return nameKey
+	}
+	if strings.HasSuffix(sourceKey, "_ref") {
+		return strings.TrimSuffix(sourceKey, "_ref") + ":name"
+	}
+	return ""
+}
+
+/*
+rank returns rank of way class (0 = highest, -1 = not matching way filter)
+*/
+func (rule *PointEnrichmentRule) rank(wayClass string) int {
+	for rank, wayValue := range rule.WayValues {
+		if wayClass == wayValue {
+			return rank
+		}
+	}
+	return -1
+}
+
+/*
+matchNode returns index of first matching node tag selector (-1 = no match)
+*/
+func (rule *PointEnrichmentRule) matchNode(tags map[string]string) int {
+	for i, selector := range rule.NodeTags {
+		value, found := tags[selector.Key]
+		if found && (selector.Value == "" || selector.Value == value) {
+			return i
+		}
+	}
+	return -1
+}
+
+/*
+Label returns descriptive label of tag selector (e.g. "turning_circle")
+*/
+func (selector TagSelector) Label() string {
+	if selector.Value == "" {
+		return selector.Key
+	}
+	return selector.Value
+}
+
+/*
+idSlot returns ID slot of source key (position of source key, counted over all node_network rules)
+*/
+func (rs *RuleSet) idSlot(ruleIndex, keyIndex int) int {
+	slot := keyIndex
+	for _, rule := range rs.NodeNetworks[:ruleIndex] {
+		slot += len(rule.SourceKeys)
+	}
+	return slot
+}
+
+/*
+IDSlots returns number of ID slots (number of source keys of all node_network rules)
+*/
+func (rs *RuleSet) IDSlots() int {
+	return rs.idSlot(len(rs.NodeNetworks), 0)
+}
+
+/*
+IsNetworkLevel checks if level is a known network level
+*/
+func IsNetworkLevel(level string) bool {
+	for _, networkLevel := range NetworkLevels {
+		if level == networkLevel {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+LoadRuleSet reads rule set from JSON file
+*/
+func LoadRuleSet(filename string) (*RuleSet, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not read rules file: %v", err)
+	}
+
+	rs := &RuleSet{}
+	err = json.Unmarshal(data, rs)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse rules file: %v", err)
+	}
+
+	err = rs.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid rules file: %v", err)
+	}
+
+	return rs, nil
+}
+
+/*
+Validate checks rule set for completeness
+*/
+func (rs *RuleSet) Validate() error {
+	if rs.NodeNetworks == nil {
+		rs.NodeNetworks = DefaultRuleSet().NodeNetworks
+	}
+	if len(rs.NodeNetworks) == 0 {
+		return fmt.Errorf("no nodeNetworks rules defined")
+	}
+	if rs.LevelKey == "" {
+		rs.LevelKey = "node_network:level"
+	}
+	if rs.JunctionNameKey == "" {
+		rs.JunctionNameKey = "node_network:name"
+	}
+	if rs.JunctionRefKey == "" {
+		rs.JunctionRefKey = "node_network:ref"
+	}
+	if rs.OriginalPositionKey == "" {
+		rs.OriginalPositionKey = "node_network:position"
+	}
+
+	if rs.PointEnrichments == nil {
+		rs.PointEnrichments = DefaultRuleSet().PointEnrichments
+	}
+	for i, rule := range rs.PointEnrichments {
+		if len(rule.NodeTags) == 0 || rule.WayKey == "" || len(rule.WayValues) == 0 || rule.OutputKey == "" {
+			return fmt.Errorf("pointEnrichments rule %d (%s): nodeTags, wayKey, wayValues or outputKey missing", i+1, rule.Name)
+		}
+	}
+
+	for i, rule := range rs.NodeNetworks {
+		if len(rule.SourceKeys) == 0 {
+			return fmt.Errorf("nodeNetworks rule %d (%s): no sourceKeys defined", i+1, rule.Network)
+		}
+		if rule.OutputKey == "" || rule.OutputValue == "" {
+			return fmt.Errorf("nodeNetworks rule %d (%s): outputKey or outputValue missing", i+1, rule.Network)
+		}
+		if rule.NameKey == "" {
+			rs.NodeNetworks[i].NameKey = "name"
+		}
+		if rule.NameSource == "" {
+			rs.NodeNetworks[i].NameSource = NameSourceRef
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,186 @@
+/*
+Purpose:
+- Pluggable processing steps (processors)
+
+Description:
+- A processing step gets every OSM object of the input (hooks Node, Way, Relation), completes its
+  work after the last object (hook Finish) and reports its statistics (hook Stats).
+- Steps are registered by name. The processor runs the selected steps in the selected order for each
+  object (default: all registered steps in order of registration).
+- Multi-pass (option MultiPass): a step may read the input several times, each pass with its own object
+  types (e.g. relations first, then ways, then nodes). IDs collected in early passes select the objects
+  of later passes, so neither all objects nor all node locations have to be kept in memory.
+- Built-in steps: node_network (new node_network objects, route relation validation) and
+  point_enrichment (point-on-way enrichment, e.g. turning_circle/loop objects).
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package process
+
+import (
+	"fmt"
+
+	"github.com/paulmach/osm"
+)
+
+// Step defines one processing step (processor)
+type Step interface {
+	Node(node *osm.Node) error
+	Way(way *osm.Way) error
+	Relation(relation *osm.Relation) error
+	Finish() error        // called after the last object
+	Stats(result *Result) // adds statistics of step to result (called after Finish)
+}
+
+// Pass defines the object types a processing step gets in one pass over the input
+type Pass struct {
+	Nodes     bool
+	Ways      bool
+	Relations bool
+}
+
+// common passes
+var (
+	PassAll       = Pass{Nodes: true, Ways: true, Relations: true}
+	PassNodes     = Pass{Nodes: true}
+	PassWays      = Pass{Ways: true}
+	PassRelations = Pass{Relations: true}
+)
+
+// MultiPassStep defines a processing step which reads the input more than once (other steps: PassAll)
+type MultiPassStep interface {
+	Step
+	Passes() []Pass         // passes in processing order (e.g. PassRelations, PassWays, PassAll)
+	EndPass(pass int) error // called after each pass (e.g. to prepare the next pass)
+}
+
+// OpenFunc opens the input for one pass
+type OpenFunc func() (osm.Scanner, error)
+
+// StepContext provides the shared state of a run to the processing steps
+type StepContext struct {
+	Options   Options
+	Rules     *RuleSet
+	NodeIDs   *NodeIDs
+	Writer    NodeWriter
+	Locations NodeLocationStore // node locations of all input nodes (nil = not needed by options)
+
+	clip *clipper    // nil = no clipping
+	dups *duplicates // nil = no de-duplication
+}
+
+/*
+KeepNewNode reports whether new nodes of source node are written (not written in an earlier run,
+inside clip area; call once per new node, before the ID is assigned)
+*/
+func (ctx *StepContext) KeepNewNode(source *osm.Node) bool {
+	if ctx.dups != nil && !ctx.dups.keepNew(source.ID) {
+		return false
+	}
+	if ctx.clip == nil {
+		return true
+	}
+	ctx.clip.stats.NewNodesBefore++
+	if !ctx.clip.keep(source.Lat, source.Lon) {
+		return false
+	}
+	ctx.clip.stats.NewNodesAfter++
+	return true
+}
+
+/*
+KeepModifiedNode reports whether modified node is written (not written in an earlier run, inside
+clip area)
+*/
+func (ctx *StepContext) KeepModifiedNode(node *osm.Node) bool {
+	if ctx.dups != nil && !ctx.dups.keepModified(node.ID) {
+		return false
+	}
+	if ctx.clip == nil {
+		return true
+	}
+	ctx.clip.stats.ModifiedNodesBefore++
+	if !ctx.clip.keep(node.Lat, node.Lon) {
+		return false
+	}
+	ctx.clip.stats.ModifiedNodesAfter++
+	return true
+}
+
+// NewStepFunc creates a processing step for one run
+type NewStepFunc func(ctx *StepContext) Step
+
+// names of built-in processing steps
+const (
+	StepNodeNetwork     = "node_network"
+	StepPointEnrichment = "point_enrichment"
+)
+
+// stepRegistration defines a registered processing step
+type stepRegistration struct {
+	name    string
+	newStep NewStepFunc
+}
+
+// registered processing steps (in default order)
+var registeredSteps = []stepRegistration{
+	{name: StepNodeNetwork, newStep: newNodeNetworkStep},
+	{name: StepPointEnrichment, newStep: newPointEnrichmentStep},
+}
+
+/*
+RegisterStep registers processing step (appended to default order)
+*/
+func RegisterStep(name string, newStep NewStepFunc) error {
+	if findStep(name) != nil {
+		return fmt.Errorf("processing step '%s' already registered", name)
+	}
+	registeredSteps = append(registeredSteps, stepRegistration{name: name, newStep: newStep})
+	return nil
+}
+
+/*
+StepNames returns names of all registered processing steps (in default order)
+*/
+func StepNames() []string {
+	names := []string{}
+	for _, registration := range registeredSteps {
+		names = append(names, registration.name)
+	}
+	return names
+}
+
+/*
+findStep returns registered processing step (nil = not registered)
+*/
+func findStep(name string) *stepRegistration {
+	for i := range registeredSteps {
+		if registeredSteps[i].name == name {
+			return &registeredSteps[i]
+		}
+	}
+	return nil
+}
+
+/*
+checkStepNames checks that all steps are registered and selected only once
+*/
+func checkStepNames(names []string) error {
+	selected := make(map[string]bool)
+	for _, name := range names {
+		if findStep(name) == nil {
+			return fmt.Errorf("unknown processing step '%s'", name)
+		}
+		if selected[name] {
+			return fmt.Errorf("processing step '%s' selected more than once", name)
+		}
+		selected[name] = true
+	}
+	return nil
+}
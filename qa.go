@@ -0,0 +1,122 @@
+/*
+Purpose:
+- Quality assurance files of OSM data pre-processing
+
+Description:
+- Writes junction nodes whose expected_*_route_relations tags do not match the actual route relation
+  membership.
+- Writes misplaced (mid-way) and orphaned point objects (e.g. turning_circle/loop nodes).
+- Both written as CSV and GeoJSON file (e.g. for review in QGIS or JOSM).
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/Klaus-Tockloth/osmpp/process"
+)
+
+/*
+writeRouteRelationQA writes route relation mismatches to CSV and GeoJSON file
+*/
+func writeRouteRelationQA(basename string, mismatches []process.RouteRelationMismatch) error {
+	// CSV file
+	records := [][]string{{"node_id", "lat", "lon", "network", "ref", "expected", "actual"}}
+	for _, mismatch := range mismatches {
+		record := []string{
+			strconv.FormatInt(int64(mismatch.NodeID), 10),
+			strconv.FormatFloat(mismatch.Lat, 'f', 7, 64),
+			strconv.FormatFloat(mismatch.Lon, 'f', 7, 64),
+			mismatch.Network,
+			mismatch.Ref,
+			strconv.Itoa(mismatch.Expected),
+			strconv.Itoa(mismatch.Actual),
+		}
+		records = append(records, record)
+	}
+	err := writeCSVFile(basename+".csv", records)
+	if err != nil {
+		return err
+	}
+
+	// GeoJSON file
+	features := []geoJSONFeature{}
+	for _, mismatch := range mismatches {
+		properties := map[string]interface{}{
+			"node_id":  int64(mismatch.NodeID),
+			"network":  mismatch.Network,
+			"ref":      mismatch.Ref,
+			"expected": mismatch.Expected,
+			"actual":   mismatch.Actual,
+		}
+		features = append(features, newPointFeature(mismatch.Lon, mismatch.Lat, properties))
+	}
+
+	return writeGeoJSONFile(basename+".geojson", features)
+}
+
+/*
+writeCSVFile writes records to CSV file
+*/
+func writeCSVFile(filename string, records [][]string) error {
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0666)
+	if err != nil {
+		return fmt.Errorf("could not open file: %v", err)
+	}
+	writer := bufio.NewWriter(file)
+	csvWriter := csv.NewWriter(writer)
+	err = csvWriter.WriteAll(records)
+	if err != nil {
+		return fmt.Errorf("error writing file: %v", err)
+	}
+	err = writer.Flush()
+	if err != nil {
+		return fmt.Errorf("could not flush file buffer: %v", err)
+	}
+
+	return file.Close()
+}
+
+/*
+writePointQA writes mid-way and orphaned point objects (e.g. turning_circle/loop nodes) to CSV and GeoJSON file
+*/
+func writePointQA(basename string, issues []process.PointIssue) error {
+	records := [][]string{{"node_id", "lat", "lon", "object", "position"}}
+	features := []geoJSONFeature{}
+
+	for _, issue := range issues {
+		record := []string{
+			strconv.FormatInt(int64(issue.NodeID), 10),
+			strconv.FormatFloat(issue.Lat, 'f', 7, 64),
+			strconv.FormatFloat(issue.Lon, 'f', 7, 64),
+			issue.Object,
+			issue.Position,
+		}
+		records = append(records, record)
+		properties := map[string]interface{}{
+			"node_id":  int64(issue.NodeID),
+			"object":   issue.Object,
+			"position": issue.Position,
+		}
+		features = append(features, newPointFeature(issue.Lon, issue.Lat, properties))
+	}
+
+	err := writeCSVFile(basename+".csv", records)
+	if err != nil {
+		return err
+	}
+
+	return writeGeoJSONFile(basename+".geojson", features)
+}
@@ -0,0 +1,94 @@
+/*
+Purpose:
+- Machine-readable statistics report
+
+Description:
+- Contains the same data as the console statistics (junction points, point objects, OSM data).
+- Several input files: totals of all files, statistics per file in 'inputs'.
+- Written as JSON document. The schema is versioned (schemaVersion), fields are only added
+  within a schema version. Removed or renamed fields result in a new schema version.
+
+Author:
+- Klaus Tockloth
+
+Copyright and license:
+- Copyright (c) 2019,2020 Klaus Tockloth
+- MIT license
+*/
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/Klaus-Tockloth/osmpp/process"
+)
+
+// version of statistics report schema
+const statsSchemaVersion = 1
+
+// statsReport defines the statistics report
+type statsReport struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Program       string `json:"program"`
+	Release       string `json:"release"`
+	InputFile     string `json:"inputFile"`
+	InputFormat   string `json:"inputFormat"`
+
+	process.Result
+
+	Inputs []*statsReport `json:"inputs,omitempty"` // per input file (only with several input files)
+}
+
+/*
+newStatsReport creates new statistics report
+*/
+func newStatsReport(inputFile string) *statsReport {
+	return &statsReport{
+		SchemaVersion: statsSchemaVersion,
+		Program:       progName,
+		Release:       progVersion,
+		InputFile:     inputFile,
+		Result:        process.Result{Points: []process.PointStats{}},
+	}
+}
+
+/*
+add adds statistics of one input file to total statistics
+*/
+func (r *statsReport) add(other *statsReport) {
+	if r.InputFormat == "" {
+		r.InputFormat = other.InputFormat
+	} else if r.InputFormat != other.InputFormat {
+		r.InputFormat = "mixed"
+	}
+
+	r.Result.Add(&other.Result)
+}
+
+/*
+writeStatsFile writes statistics report as JSON document to file
+*/
+func writeStatsFile(filename string, report *statsReport) error {
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0666)
+	if err != nil {
+		return fmt.Errorf("could not open file: %v", err)
+	}
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(report)
+	if err != nil {
+		return fmt.Errorf("error writing file: %v", err)
+	}
+	err = writer.Flush()
+	if err != nil {
+		return fmt.Errorf("could not flush file buffer: %v", err)
+	}
+
+	return file.Close()
+}